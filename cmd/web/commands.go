@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"snippetbox.linze.me/internal/models"
+	"snippetbox.linze.me/internal/validator"
+)
+
+// The usage text for the management commands, which is shown if a command can't be parsed.
+const commandUsage = `usage:
+  web [flags] user promote <email> <role>    change the role of a user (one of: user, moderator, admin)
+  web [flags] invite create [email]          create an invite, optionally for a single email address`
+
+// The runCommand() method runs a management command given as command-line arguments, like "user promote alice@example.com admin",
+// writing any output to w. This lets operators do things like bootstrapping the first admin user without having to write any SQL.
+func (app *application) runCommand(w io.Writer, args []string) error {
+	if len(args) == 4 && args[0] == "user" && args[1] == "promote" {
+		email, role := args[2], args[3]
+
+		if !validator.PermittedValue(role, models.Roles...) {
+			return fmt.Errorf("invalid role %q\n%s", role, commandUsage)
+		}
+
+		err := app.users.SetRole(email, role)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				return fmt.Errorf("no user with email %q", email)
+			}
+			return err
+		}
+
+		fmt.Fprintf(w, "User %s now has the role %s\n", email, role)
+		return nil
+	}
+
+	// Invites can be created from the command line, so that the first users can sign up when registration is by invitation only.
+	if (len(args) == 2 || len(args) == 3) && args[0] == "invite" && args[1] == "create" {
+		invite := &models.Invite{Expires: time.Now().Add(inviteLifetime)}
+		if len(args) == 3 {
+			invite.Email = args[2]
+			if !validator.Matches(invite.Email, validator.EmailRX) {
+				return fmt.Errorf("invalid email %q\n%s", invite.Email, commandUsage)
+			}
+		}
+
+		err := app.invites.Insert(invite)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "Created invite, which can be used once in the next %s at /user/signup?invite=%s\n", humanDuration(inviteLifetime), invite.Code)
+		return nil
+	}
+
+	return errors.New(commandUsage)
+}
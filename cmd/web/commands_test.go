@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"snippetbox.linze.me/internal/assert"
+)
+
+func TestRunCommand(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantErr    bool
+		wantOutput string
+	}{
+		{name: "Promote", args: []string{"user", "promote", "alice@email.com", "admin"}, wantOutput: "User alice@email.com now has the role admin\n"},
+		{name: "Role already set", args: []string{"user", "promote", "bob@email.com", "admin"}, wantOutput: "User bob@email.com now has the role admin\n"},
+		{name: "Invalid role", args: []string{"user", "promote", "alice@email.com", "superuser"}, wantErr: true},
+		{name: "Unknown user", args: []string{"user", "promote", "nobody@email.com", "admin"}, wantErr: true},
+		{name: "Invite", args: []string{"invite", "create"}, wantOutput: "Created invite, which can be used once in the next 7 days at /user/signup?invite=N3w-Inv1te-Code-123456\n"},
+		{name: "Invite for an email address", args: []string{"invite", "create", "carol@example.com"}, wantOutput: "Created invite, which can be used once in the next 7 days at /user/signup?invite=N3w-Inv1te-Code-123456\n"},
+		{name: "Invite for an invalid email address", args: []string{"invite", "create", "carol"}, wantErr: true},
+		{name: "Unknown command", args: []string{"user", "delete", "alice@email.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := app.runCommand(&buf, tt.args)
+
+			assert.Equal(t, err != nil, tt.wantErr)
+			assert.Equal(t, buf.String(), tt.wantOutput)
+		})
+	}
+}
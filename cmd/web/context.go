@@ -3,3 +3,7 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+const authenticatedUserContextKey = contextKey("authenticatedUser")
+
+const orgRolesContextKey = contextKey("orgRoles")
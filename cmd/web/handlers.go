@@ -1,16 +1,25 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	// "strings"
 	// "unicode/utf8"
 
+	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/julienschmidt/httprouter"
+	"golang.org/x/oauth2"
+	"snippetbox.linze.me/internal/diff"
+	"snippetbox.linze.me/internal/highlight"
 	"snippetbox.linze.me/internal/models"
 	"snippetbox.linze.me/internal/validator"
 )
@@ -21,23 +30,80 @@ import (
 // Remove the explicit FieldErrors struct field and instead embed the Validator type.
 // Embedding this means that our snippetCreateForm "inherits" all the fields and methods of our Validator type (including the FieldErrors field).
 type snippetCreateForm struct {
-	Title   string
-	Content string
-	Expires int
+	Title            string
+	Files            []*models.File
+	Expires          string // one of the expiryPresets, "never", "duration" or "date"
+	ExpiresIn        string // a custom duration like "90m" or "36h", used when Expires is "duration"
+	ExpiresAt        string // a date and time from a datetime-local input, used when Expires is "date"
+	TimezoneOffset   int    // the browser's offset from UTC in minutes, as returned by Date.getTimezoneOffset()
+	Visibility       string
+	BurnAfterReading bool
+	Password         string
+	Encrypted        bool
+	Fork             string // the slug of the snippet being forked, if any
+	Tags             string // a comma-separated list of tags, as entered by the user
+	Org              string // the slug of the organization which will own the snippet, or "" for a personal snippet
 	// FieldErrors map[string]string
 	validator.Validator
 }
 
+type snippetEditForm struct {
+	Title               string         `form:"title"`
+	Files               []*models.File `form:"-"` // read with filesFromPostForm(), since each file has several fields
+	validator.Validator `form:"-"`
+}
+
+type commentForm struct {
+	Content             string `form:"content"`
+	ParentID            int    `form:"parent_id"` // the ID of the comment being replied to, or 0 for a new thread
+	File                int    `form:"file"`      // the position of the file, and the range of lines, which a line comment is about
+	LineStart           int    `form:"line_start"`
+	LineEnd             int    `form:"line_end"`
+	validator.Validator `form:"-"`
+}
+
+type collectionForm struct {
+	Title               string `form:"title"`
+	Description         string `form:"description"`
+	Visibility          string `form:"visibility"`
+	validator.Validator `form:"-"`
+}
+
+type orgForm struct {
+	Slug                string `form:"slug"`
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+type orgMemberForm struct {
+	Username            string `form:"username"`
+	Role                string `form:"role"`
+	validator.Validator `form:"-"`
+}
+
+type snippetUnlockForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
 type userSignupForm struct {
 	Name                string `form:"name"`
+	Username            string `form:"username"`
 	Email               string `form:"email"`
 	Password            string `form:"password"`
+	Invite              string `form:"invite"` // the invite code from the signup link, if any
 	validator.Validator `form:"-"`
 }
 
-type userLoginForm struct {
+type inviteForm struct {
 	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+type userLoginForm struct {
+	Login               string `form:"login"` // either a username or an email address
 	Password            string `form:"password"`
+	RememberMe          bool   `form:"remember"`
 	validator.Validator `form:"-"`
 }
 
@@ -64,9 +130,25 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Fetch the snippets which have been starred the most in the last week.
+	mostStarred, err := app.snippets.MostStarred(7*24*time.Hour, mostStarredSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Fetch the most used tags for the tag cloud.
+	tags, err := app.snippets.TagCloud(tagCloudSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	// Call the newTemplateData() helper to get a templateData struct containing the 'default' data (which for now is just the current year), and add the snippets slice to it.
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
+	data.Tags = tags
+	data.MostStarred = mostStarred
 
 	// Use the new render helper
 
@@ -126,6 +208,111 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	*/
 }
 
+// The tagView handler lists the live, public snippets with a tag, a page at a time.
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	// There can't be any snippets with an invalid tag, so there's no need to hit the database.
+	tag := params.ByName("tag")
+	if !validator.Matches(tag, models.TagRX) {
+		app.notFound(w)
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippets, total, err := app.snippets.Tagged(tag, pageSize, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The first page is shown even if it's empty, but there's nothing to see on later pages beyond the end of the list.
+	if page > 1 && len(snippets) == 0 {
+		app.notFound(w)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tag = tag
+	data.Snippets = snippets
+	data.Pagination = newPagination("/tags/"+tag, page, pageSize, total)
+
+	app.render(w, http.StatusOK, "tag.tmpl", data)
+}
+
+// The userProfile handler shows a user's name and join date, along with their live, public snippets a page at a time.
+// Profiles are identified by username, like /u/alice.
+func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.profileFromParams(w, r, "")
+	if !ok {
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippets, total, err := app.snippets.ByUser(user.ID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if page > 1 && len(snippets) == 0 {
+		app.notFound(w)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Profile = user
+	data.Snippets = snippets
+	data.Pagination = newPagination("/u/"+user.Username, page, pageSize, total)
+
+	app.render(w, http.StatusOK, "profile.tmpl", data)
+}
+
+// The userStarred handler lists the live snippets a user has starred, a page at a time.
+// Everyone can see the public snippets a user has starred, but only the user themselves can see their starred unlisted (and their own private) snippets.
+func (app *application) userStarred(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.profileFromParams(w, r, "/starred")
+	if !ok {
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	own := app.authenticatedUser(r) != nil && app.authenticatedUser(r).ID == user.ID
+
+	snippets, total, err := app.snippets.Starred(user.ID, own, pageSize, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if page > 1 && len(snippets) == 0 {
+		app.notFound(w)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Profile = user
+	data.Snippets = snippets
+	data.Pagination = newPagination("/u/"+user.Username+"/starred", page, pageSize, total)
+
+	app.render(w, http.StatusOK, "starred.tmpl", data)
+}
+
 // Change the signature of the snippetView handler so it is defined as a method
 // against *application
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
@@ -134,29 +321,39 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	// you can use the ParamsFromContext() function to retrieve a slice containing these parameter names and values like so:
 	params := httprouter.ParamsFromContext(r.Context())
 
-	// Extract the value of the id parameter from the query string and try to
-	// convert it to an integer using the strconv.Atoi() function. If it can't
-	// be converted to an integer, or the value is less than 1, we return a 404 page
-	// not found response.
+	// Snippets used to be identified in URLs by their numeric ID.
+	// If the slug parameter is all digits, we treat it as an old-style URL and redirect to the snippet's new URL -- but only for public snippets,
+	// so that the old URLs can't be used to enumerate unlisted or private ones.
+	if slug := params.ByName("slug"); validator.Matches(slug, legacyIDRX) {
+		id, err := strconv.Atoi(slug)
+		if err != nil {
+			app.notFound(w)
+			return
+		}
+		app.redirectLegacySnippetURL(w, r, id)
+		return
+	}
 
-	// We can then use the ByName() method to get the value of the "id" named parameter from the slice and validate it as normal.
-	// id, err := strconv.Atoi(r.URL.Query().Get("id"))
-	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil || id < 1 {
-		// http.NotFound(w, r)
-		app.notFound(w) // Use the notFound() helper
+	// Otherwise fetch the snippet using the slug, checking that the current user is allowed to view it.
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
 		return
 	}
 
-	// Use the SnippetModel object's Get method to retrieve the data for a
-	// specific record based on its ID. If no matching record is found, return a 404 Not Found response.
-	snippet, err := app.snippets.Get(id)
-	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w)
-		} else {
-			app.serverError(w, err)
-		}
+	// If the snippet is protected by a password which the user hasn't entered yet, show the unlock form instead of the snippet.
+	if !app.isUnlocked(r, snippet) {
+		app.renderUnlockForm(w, r, http.StatusOK, snippet, snippetUnlockForm{})
+		return
+	}
+
+	// Snippets which are burned after reading aren't shown straight away. Instead we show an interstitial page with a button to reveal the content,
+	// which sends a POST request. This stops link previews and other bots which follow links from burning the snippet before the recipient sees it.
+	if snippet.BurnAfterReading {
+		w.Header().Set("Cache-Control", "no-store")
+
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		app.render(w, http.StatusOK, "reveal.tmpl", data)
 		return
 	}
 
@@ -166,8 +363,99 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	// No need to add this line of code, because we are using the newTemplateData() helper to do this for us.
 	// flash := app.sessionManager.PopString(r.Context(), "flash")
 
+	// Fetch the snippet's parent, if it's a fork, and any forks of it. We only show the ones which the user would be able to find anyway.
+	var parent *models.Snippet
+	var err error
+	if snippet.ParentID != 0 {
+		parent, err = app.snippets.Get(snippet.ParentID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	forks, err := app.snippets.Forks(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Check whether the user has starred the snippet, so that the star button can be shown in the right state.
+	var starred bool
+	if user := app.authenticatedUser(r); user != nil {
+		starred, err = app.snippets.IsStarred(snippet.ID, user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	comments, err := app.comments.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Line comments (and their replies) are shown next to the lines they're about, rather than with the rest of the comments.
+	lines, comments, err := snippetLines(snippet, comments)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// If the snippet belongs to an organization, link to the organization's page.
+	var org *models.Org
+	if snippet.OrgID != 0 {
+		org, err = app.orgs.Get(snippet.OrgID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	data.Org = org
+	data.Lines = lines
+	data.CanEdit = app.canEdit(r, snippet)
+	data.CanFork = app.canFork(r, snippet)
+	data.Starred = starred
+	data.Comments = comments
+	data.CanComment = app.canComment(r, snippet)
+	data.EditableComments = map[int]bool{}
+	for _, comment := range comments {
+		data.EditableComments[comment.ID] = app.canModifyComment(r, snippet, comment)
+	}
+
+	// Users can add the snippet to, or remove it from, any of their collections.
+	data.CanCollect = app.canCollect(r, snippet)
+	if data.CanCollect {
+		user := app.authenticatedUser(r)
+		data.Collections, err = app.collections.ByUser(user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		ids, err := app.collections.Containing(user.ID, snippet.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		data.InCollections = map[int]bool{}
+		for _, id := range ids {
+			data.InCollections[id] = true
+		}
+	}
+	if parent != nil && app.isListed(r, parent) {
+		data.Parent = parent
+	}
+	for _, fork := range forks {
+		if app.isListed(r, fork) {
+			data.Snippets = append(data.Snippets, fork)
+		}
+	}
 	// Same as before, we pass the flash message to the template data.
 	// data.Flash = flash
 
@@ -210,95 +498,1199 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	*/
 }
 
-func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-
-	// Initialize a new createSnippetForm instance and pass it to the template.
-	// Notice how this is also a great opportunity to set any default or 'initial' values for the form --- here we set the initial value for the snippet expiry to 365 days.
-	data.Form = snippetCreateForm{
-		Expires: 365,
+func (app *application) snippetRevealPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
 	}
-	app.render(w, http.StatusOK, "create.tmpl", data)
-}
 
-// Change the signature of the snippetCreate handler so it is defined as a method
-// against *application.
+	// There's nothing to reveal for normal snippets, so just send the user to the snippet page.
+	// The same goes if the snippet is protected by a password which hasn't been entered yet -- the snippet page will show the unlock form.
+	if !snippet.BurnAfterReading || !app.isUnlocked(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+		return
+	}
 
-// Rename this handler to snippetCreatePost.
-func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
-	// Checking if the request method is a POST is now superfluous and can be removed, because this is done automatically by httprouter.
-	/*
-		if r.Method != http.MethodPost {
-			w.Header().Set("Allow", http.MethodPost)
-			// http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-			app.clientError(w, http.StatusMethodNotAllowed) // Use the clientError() helper
-			return
+	// Atomically fetch and delete the snippet. If someone else has revealed it in the meantime, it won't exist any more and we send a 404 Not Found response.
+	snippet, err := app.snippets.Burn(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
 		}
-	*/
+		return
+	}
 
-	// First we call r.ParseForm() which adds any data in POST request bodies to the r.PostForm map. This also works in the same way for PUT and PATCH requests.
-	// If there are any errors, we use our app.ClientError() helper to send a 400 Bad Request response to the user.
-	err := r.ParseForm()
+	// Render the snippet directly, rather than redirecting, because it no longer exists in the database.
+	// Make sure that the page isn't stored in the browser cache (or any other cache), since it can't be viewed again.
+	w.Header().Set("Cache-Control", "no-store")
+
+	lines, _, err := snippetLines(snippet, nil)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.serverError(w, err)
 		return
 	}
-	/*
-		// Use the r.PostForm.Get() method to retrieve the title and content from the r.PostForm map.
-		title := r.PostForm.Get("title")
-		content := r.PostForm.Get("content")
-	*/
 
-	// The r.PostForm.Get() method always returns the form data as a *string*.
-	// However, we're expecting our expires value to be a number, and want to represent it in our Go code as an integer.
-	// So we need to manually covert the form data to an integer using strconv.Atoi(), and we send a 400 Bad Request response if the conversion fails.
-	expires, err := strconv.Atoi(r.PostForm.Get("expires"))
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Lines = lines
+	data.Flash = "This snippet has now been deleted. Make a copy of it if you need to, because it can't be viewed again."
+	app.render(w, http.StatusOK, "view.tmpl", data)
+}
+
+func (app *application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetUnlockForm
+	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Create an instance of the snippetCreateForm struct containing the values from the form and an empty map for any validation errors.
-	form := snippetCreateForm{
-		Title:   r.PostForm.Get("title"),
-		Content: r.PostForm.Get("content"),
-		Expires: expires,
-		// FieldErrors: map[string]string{},
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	if !form.Valid() {
+		app.renderUnlockForm(w, r, http.StatusUnprocessableEntity, snippet, form)
+		return
 	}
 
-	// Because the Validator type is embedded by the snippetCreateForm struct, we can call CheckField() directly on it to execute our validation checks.
-	// CheckField() will add the provided key and error message to the  FieldErrors map if the check does not evaluate to true.
-	// For example, in the first line here we "check that the form.Title field is not blank".
-	// In the second, we "check that the form.Title field has a maximum character length of 100" and so on.
-	form.CheckField(validator.NotBlank(form.Title), "title", "must not be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "must not be more than 100 characters")
-	form.CheckField(validator.NotBlank(form.Content), "content", "must not be blank")
-	// Use the generic PermittedValue() function instead of the type-specific PermittedInt() function.
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "must be a valid expiry period")
-
-	// Use the Valid() method to see if any of the checks failed. If they did, then re-render the template passing in the form in the same way as before.
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
+	match, err := snippet.PasswordMatches(form.Password)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !match {
+		form.AddNonFieldError("The password is incorrect")
+		app.renderUnlockForm(w, r, http.StatusUnprocessableEntity, snippet, form)
 		return
 	}
 
-	/*
-		// Check that the title value is not blank and is not more than 100 characters long.
-		// If it fails either of those checks, add a message to the errors map using the field name as the key.
+	// Remember that the user has unlocked the snippet, so that they don't need to enter the password again for the rest of their session.
+	unlocked, _ := app.sessionManager.Get(r.Context(), "unlockedSnippets").([]string)
+	app.sessionManager.Put(r.Context(), "unlockedSnippets", append(unlocked, snippet.Slug))
 
-		// Update the validation checks so that they operate on the snippetCreateForm instance.
-		if strings.TrimSpace(form.Title) == "" {
-			form.FieldErrors["title"] = "This field cannot be blank"
-		} else if utf8.RuneCountInString(form.Title) > 100 {
-			form.FieldErrors["title"] = "This field cannot be more than 100 characters long"
-		}
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+}
 
-		// Check that the content value isn't blank.
-		if strings.TrimSpace(form.Content) == "" {
-			form.FieldErrors["content"] = "This field cannot be blank"
-		}
+// The snippetRaw handler sends the content of a snippet as plain text, which is handy for downloading it or using it from the command line.
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	// There's no way to enter a password here, so if the snippet hasn't been unlocked in the user's session we send a 403 Forbidden response.
+	if !app.isUnlocked(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	// Snippets which are burned after reading can only be revealed from the snippet page.
+	if snippet.BurnAfterReading {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+		return
+	}
+
+	// By default we send the first file, but any of the files can be chosen by name using the "file" query string parameter.
+	file := snippet.Files[0]
+	if name := r.URL.Query().Get("file"); name != "" {
+		file = nil
+		for i, f := range snippet.Files {
+			if f.DisplayName(i) == name {
+				file = f
+				break
+			}
+		}
+		if file == nil {
+			app.notFound(w)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if snippet.HasPassword() || snippet.Visibility == models.VisibilityPrivate || snippet.Visibility == models.VisibilityOrg {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.Write([]byte(file.Content))
+}
+
+// The snippetDownload handler sends all of the files in a snippet as a zip archive.
+// The same rules apply as for the raw content of the snippet.
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.isUnlocked(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	if snippet.BurnAfterReading {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+		return
+	}
+
+	// Write the archive to a buffer first, so that we can still send an error response if anything goes wrong.
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	for i, file := range snippet.Files {
+		header := &zip.FileHeader{
+			Name:     file.DisplayName(i),
+			Method:   zip.Deflate,
+			Modified: snippet.Created,
+		}
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		_, err = fw.Write([]byte(file.Content))
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, snippet.Slug))
+	if snippet.HasPassword() || snippet.Visibility == models.VisibilityPrivate || snippet.Visibility == models.VisibilityOrg {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	buf.WriteTo(w)
+}
+
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.canEdit(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetEditForm{
+		Title: snippet.Title,
+		Files: snippet.Files,
+	}
+	data.Languages = highlight.Languages
+	app.render(w, http.StatusOK, "edit.tmpl", data)
+}
+
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.canEdit(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	var form snippetEditForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.Files = filesFromPostForm(r)
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "must not be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "must not be more than 100 characters")
+	checkFiles(&form.Validator, form.Files, false)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		data.Languages = highlight.Languages
+		app.render(w, http.StatusUnprocessableEntity, "edit.tmpl", data)
+		return
+	}
+
+	snippet.Title = form.Title
+	snippet.Files = form.Files
+
+	err = app.snippets.Update(snippet, app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+}
+
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.historySnippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	data.CanEdit = app.canEdit(r, snippet)
+	app.render(w, http.StatusOK, "history.tmpl", data)
+}
+
+// The snippetDiff handler shows the changes between two revisions of a snippet, identified by the "from" and "to" query string parameters.
+// If "to" is missing we use the latest revision, and if "from" is missing we use the revision before "to" -- so with no parameters at all, it shows the most recent change.
+// The "view" parameter chooses between a unified diff (the default) and a side-by-side one.
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.historySnippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if len(revisions) == 0 {
+		app.notFound(w)
+		return
+	}
+
+	// findRevision() returns the index of the revision whose ID is given in the query string parameter, or fallback if the parameter is missing.
+	// The revisions are ordered newest first, so the revision before revisions[i] is revisions[i+1].
+	findRevision := func(param string, fallback int) (int, bool) {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			return fallback, true
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, false
+		}
+		for i, revision := range revisions {
+			if revision.ID == id {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+
+	to, ok := findRevision("to", 0)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+	from, ok := findRevision("from", to+1)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	view := r.URL.Query().Get("view")
+	if !validator.PermittedValue(view, "unified", "split") {
+		view = "unified"
+	}
+
+	d := &revisionDiff{To: revisions[to], View: view}
+
+	// If there's no revision before "to" (because it's the first one), we diff against an empty snippet.
+	var fromFiles []*models.File
+	if from < len(revisions) {
+		d.From = revisions[from]
+		fromFiles = d.From.Files
+	}
+
+	d.Files, err = diffFiles(fromFiles, d.To.Files, view)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	data.Diff = d
+	app.render(w, http.StatusOK, "diff.tmpl", data)
+}
+
+func (app *application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.canEdit(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostForm.Get("revision"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	for _, revision := range revisions {
+		if revision.ID != id {
+			continue
+		}
+
+		// Restoring a revision doesn't rewrite the history. Instead, it creates a new revision with the same title and files as the old one.
+		snippet.Title = revision.Title
+		snippet.Files = revision.Files
+
+		err = app.snippets.Update(snippet, app.authenticatedUser(r).ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Revision %d successfully restored!", revision.Number))
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug+"/history", http.StatusSeeOther)
+		return
+	}
+
+	app.notFound(w)
+}
+
+func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	// Initialize a new createSnippetForm instance and pass it to the template.
+	// Notice how this is also a great opportunity to set any default or 'initial' values for the form --- here we set the initial value for the snippet expiry to the longest preset which the user is allowed to choose.
+	// The organization's page links here with its slug in the query string, so that the snippet belongs to the organization by default.
+	form := snippetCreateForm{
+		Visibility: models.VisibilityPublic,
+		Org:        r.URL.Query().Get("org"),
+	}
+	for _, option := range app.expiryOptions(app.authenticatedUser(r)) {
+		if option.Value != "never" {
+			form.Expires = option.Value
+		}
+	}
+
+	// If the user is forking a snippet, pre-fill the form with its title and content.
+	if slug := r.URL.Query().Get("fork"); slug != "" {
+		source, err := app.forkSource(r, slug)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		form.Title = source.Title
+		form.Fork = source.Slug
+		form.Tags = strings.Join(source.Tags, ", ")
+		for _, file := range source.Files {
+			form.Files = append(form.Files, &models.File{Name: file.Name, Language: file.Language, Content: file.Content})
+		}
+	}
+
+	app.renderCreateForm(w, r, http.StatusOK, form)
+}
+
+// The snippetStarPost handler stars or unstars a snippet for the logged-in user, depending on the value of the "starred" form field.
+// Using an explicit value rather than toggling means that submitting the form twice (say, from two open tabs) has the result the user expects.
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	// Snippets which are burned after reading disappear once they've been viewed, so there's no point starring them.
+	if snippet.BurnAfterReading {
+		app.notFound(w)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.authenticatedUser(r).ID
+
+	switch r.PostForm.Get("starred") {
+	case "true":
+		err = app.snippets.Star(snippet.ID, userID)
+	case "false":
+		err = app.snippets.Unstar(snippet.ID, userID)
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+}
+
+// The snippetCommentPost handler adds a comment to a snippet, or a reply to one of its comments.
+func (app *application) snippetCommentPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	// If the snippet is protected by a password which hasn't been entered yet, send the user to the snippet page to enter it.
+	if !app.isUnlocked(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+		return
+	}
+
+	if !app.canComment(r, snippet) {
+		app.notFound(w)
+		return
+	}
+
+	var form commentForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	validateComment(&form)
+
+	// Replies have to be to a comment on the same snippet, which hasn't been deleted since the page was loaded.
+	if form.ParentID != 0 {
+		parent, err := app.comments.Get(form.ParentID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+		if err != nil || parent.SnippetID != snippet.ID {
+			form.AddNonFieldError("The comment you're replying to is no longer available")
+			form.ParentID = 0
+		}
+	}
+
+	// Replies are shown with the comment they reply to, so only new threads can be about particular lines.
+	// Those lines have to still be in the snippet, which might have been edited since the page was loaded.
+	if form.ParentID != 0 {
+		form.File, form.LineStart, form.LineEnd = 0, 0, 0
+	}
+	if form.LineStart != 0 || form.LineEnd != 0 {
+		if snippet.Encrypted || !validLineRange(snippet, form.File, form.LineStart, form.LineEnd) {
+			form.AddNonFieldError("The lines you're commenting on are no longer in the snippet")
+			form.File, form.LineStart, form.LineEnd = 0, 0, 0
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "comment.tmpl", data)
+		return
+	}
+
+	comment := &models.Comment{
+		SnippetID: snippet.ID,
+		ParentID:  form.ParentID,
+		UserID:    app.authenticatedUser(r).ID,
+		File:      form.File,
+		LineStart: form.LineStart,
+		LineEnd:   form.LineEnd,
+		Content:   form.Content,
+	}
+
+	err = app.comments.Insert(comment)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your comment has been posted.")
+
+	http.Redirect(w, r, commentURL(snippet, comment.ID), http.StatusSeeOther)
+}
+
+func (app *application) commentEdit(w http.ResponseWriter, r *http.Request) {
+	comment, snippet, ok := app.commentFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Comment = comment
+	data.Form = commentForm{Content: comment.Content}
+	app.render(w, http.StatusOK, "comment.tmpl", data)
+}
+
+func (app *application) commentEditPost(w http.ResponseWriter, r *http.Request) {
+	comment, snippet, ok := app.commentFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	var form commentForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	validateComment(&form)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Comment = comment
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "comment.tmpl", data)
+		return
+	}
+
+	err = app.comments.Update(comment.ID, form.Content)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment successfully updated!")
+
+	http.Redirect(w, r, commentURL(snippet, comment.ID), http.StatusSeeOther)
+}
+
+func (app *application) commentDeletePost(w http.ResponseWriter, r *http.Request) {
+	comment, snippet, ok := app.commentFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.comments.Delete(comment.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The comment has been deleted.")
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+}
+
+// The snippetCollectPost handler adds a snippet to one of the user's collections, or removes it from one.
+func (app *application) snippetCollectPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.canCollect(r, snippet) {
+		app.notFound(w)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The collection has to be one of the user's own. We don't reveal whether other users' collections exist.
+	collection, err := app.collections.GetBySlug(r.PostForm.Get("collection"))
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	if err != nil || !app.ownsCollection(r, collection) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var flash string
+	switch r.PostForm.Get("action") {
+	case "add":
+		err = app.collections.AddSnippet(collection.ID, snippet.ID)
+		flash = fmt.Sprintf("Added to %s.", collection.Title)
+	case "remove":
+		err = app.collections.RemoveSnippet(collection.ID, snippet.ID)
+		flash = fmt.Sprintf("Removed from %s.", collection.Title)
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", flash)
+
+	// Don't add a fragment to the URL, in case the snippet is encrypted: the browser keeps the one from the form's action instead.
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+}
+
+func (app *application) collectionView(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.collectionFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	snippets, err := app.collections.Snippets(collection.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	items, err := app.collectionItems(r, snippets)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.CollectionItems = items
+	data.CanEdit = app.ownsCollection(r, collection)
+	app.render(w, http.StatusOK, "collection.tmpl", data)
+}
+
+func (app *application) collectionCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = collectionForm{Visibility: models.VisibilityPublic}
+	app.render(w, http.StatusOK, "collection_form.tmpl", data)
+}
+
+func (app *application) collectionCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form collectionForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	validateCollection(&form)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "collection_form.tmpl", data)
+		return
+	}
+
+	collection := &models.Collection{
+		UserID:      app.authenticatedUser(r).ID,
+		Title:       form.Title,
+		Description: form.Description,
+		Visibility:  form.Visibility,
+	}
+
+	err = app.collections.Insert(collection)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection successfully created! Add snippets to it from their pages.")
+
+	http.Redirect(w, r, "/collection/"+collection.Slug, http.StatusSeeOther)
+}
+
+func (app *application) collectionEdit(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollectionFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.Form = collectionForm{
+		Title:       collection.Title,
+		Description: collection.Description,
+		Visibility:  collection.Visibility,
+	}
+	app.render(w, http.StatusOK, "collection_form.tmpl", data)
+}
+
+func (app *application) collectionEditPost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollectionFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	var form collectionForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	validateCollection(&form)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Collection = collection
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "collection_form.tmpl", data)
+		return
+	}
+
+	collection.Title = form.Title
+	collection.Description = form.Description
+	collection.Visibility = form.Visibility
+
+	err = app.collections.Update(collection)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection successfully updated!")
+
+	http.Redirect(w, r, "/collection/"+collection.Slug, http.StatusSeeOther)
+}
+
+func (app *application) collectionDeletePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollectionFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.collections.Delete(collection.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The collection has been deleted. The snippets in it haven't been affected.")
+
+	http.Redirect(w, r, "/account/collections", http.StatusSeeOther)
+}
+
+// The collectionArrangePost handler moves a snippet up or down a collection, or removes it, from the buttons on the collection page.
+func (app *application) collectionArrangePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollectionFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The snippet is looked up by its slug, like everywhere else. It might have expired or been deleted since the page was loaded.
+	snippet, err := app.snippets.GetBySlug(r.PostForm.Get("snippet"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	switch r.PostForm.Get("action") {
+	case "up", "down":
+		err = app.collections.MoveSnippet(collection.ID, snippet.ID, r.PostForm.Get("action") == "up")
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	case "remove":
+		err = app.collections.RemoveSnippet(collection.ID, snippet.ID)
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/collection/"+collection.Slug, http.StatusSeeOther)
+}
+
+func (app *application) accountCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := app.collections.ByUser(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collections = collections
+	app.render(w, http.StatusOK, "account_collections.tmpl", data)
+}
+
+// The orgView handler shows an organization's snippets a page at a time. Everyone can see its public snippets,
+// but only its members can see the rest of them, and who the other members are.
+func (app *application) orgView(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.orgFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	app.renderOrg(w, r, http.StatusOK, org, page, orgMemberForm{Role: models.OrgRoleMember})
+}
+
+func (app *application) orgCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = orgForm{}
+	app.render(w, http.StatusOK, "org_create.tmpl", data)
+}
+
+func (app *application) orgCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form orgForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "must not be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "must not be more than 100 characters")
+	form.CheckField(validator.Matches(form.Slug, models.OrgSlugRX), "slug", "must be 3 to 30 lowercase letters, numbers, hyphens or underscores, starting with a letter")
+
+	if form.Valid() {
+		org := &models.Org{Slug: form.Slug, Name: form.Name}
+		err = app.orgs.Insert(org, app.authenticatedUser(r).ID)
+		if err == nil {
+			app.sessionManager.Put(r.Context(), "flash", "Organization successfully created! Add members to it below.")
+			http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+			return
+		}
+		if !errors.Is(err, models.ErrDuplicateSlug) {
+			app.serverError(w, err)
+			return
+		}
+		form.AddFieldError("slug", "is already in use")
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, http.StatusUnprocessableEntity, "org_create.tmpl", data)
+}
+
+// The orgMemberPost handler adds a user to an organization, or changes the role of a member. Only the organization's owners can do that.
+func (app *application) orgMemberPost(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.orgFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	if app.orgRole(r, org.ID) != models.OrgRoleOwner {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	var form orgMemberForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Username), "username", "must not be blank")
+	form.CheckField(validator.PermittedValue(form.Role, models.OrgRoles...), "role", "must be owner or member")
+
+	var user *models.User
+	if form.Valid() {
+		user, err = app.users.GetByUsername(strings.TrimSpace(form.Username))
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("username", "must be the username of an existing user")
+		}
+	}
+
+	// An organization must always have an owner, or nobody would be able to manage it.
+	if form.Valid() && form.Role != models.OrgRoleOwner {
+		members, err := app.orgs.Members(org.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		form.CheckField(!isLastOwner(members, user.ID), "role", "can't be changed, because they're the organization's only owner")
+	}
+
+	if !form.Valid() {
+		app.renderOrg(w, r, http.StatusUnprocessableEntity, org, 1, form)
+		return
+	}
+
+	err = app.orgs.SetMember(org.ID, user.ID, form.Role)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	role := "a member"
+	if form.Role == models.OrgRoleOwner {
+		role = "an owner"
+	}
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s is now %s of %s.", user.Name, role, org.Name))
+
+	http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+}
+
+// The orgMemberRemovePost handler removes a member from an organization. Owners can remove anyone, and members can remove themselves to leave it,
+// but the last owner can't be removed.
+func (app *application) orgMemberRemovePost(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.orgFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PostForm.Get("user_id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	role := app.orgRole(r, org.ID)
+	self := userID == app.authenticatedUser(r).ID
+	if role != models.OrgRoleOwner && !(self && role != "") {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	members, err := app.orgs.Members(org.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	var member *models.Member
+	for _, m := range members {
+		if m.UserID == userID {
+			member = m
+		}
+	}
+	if member == nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if isLastOwner(members, userID) {
+		form := orgMemberForm{Role: models.OrgRoleMember}
+		form.AddNonFieldError("An organization must have at least one owner. Make someone else an owner first.")
+		app.renderOrg(w, r, http.StatusUnprocessableEntity, org, 1, form)
+		return
+	}
+
+	err = app.orgs.RemoveMember(org.ID, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if self {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You have left %s.", org.Name))
+		http.Redirect(w, r, "/account/orgs", http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s has been removed from %s.", member.Name, org.Name))
+	http.Redirect(w, r, "/org/"+org.Slug, http.StatusSeeOther)
+}
+
+func (app *application) accountOrgs(w http.ResponseWriter, r *http.Request) {
+	orgs, err := app.orgs.ForUser(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Orgs = orgs
+	app.render(w, http.StatusOK, "account_orgs.tmpl", data)
+}
+
+// Change the signature of the snippetCreate handler so it is defined as a method
+// against *application.
+
+// Rename this handler to snippetCreatePost.
+func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
+	// Checking if the request method is a POST is now superfluous and can be removed, because this is done automatically by httprouter.
+	/*
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			// http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			app.clientError(w, http.StatusMethodNotAllowed) // Use the clientError() helper
+			return
+		}
+	*/
+
+	// First we call r.ParseForm() which adds any data in POST request bodies to the r.PostForm map. This also works in the same way for PUT and PATCH requests.
+	// If there are any errors, we use our app.ClientError() helper to send a 400 Bad Request response to the user.
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	/*
+		// Use the r.PostForm.Get() method to retrieve the title and content from the r.PostForm map.
+		title := r.PostForm.Get("title")
+		content := r.PostForm.Get("content")
+	*/
+
+	// The r.PostForm.Get() method always returns the form data as a *string*.
+	// However, we're expecting the timezone offset to be a number, so we need to manually convert it to an integer using strconv.Atoi(),
+	// and we send a 400 Bad Request response if the conversion fails. The offset is set by JavaScript, so if it's missing we assume UTC.
+	timezoneOffset := 0
+	if value := r.PostForm.Get("timezone_offset"); value != "" {
+		timezoneOffset, err = strconv.Atoi(value)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Create an instance of the snippetCreateForm struct containing the values from the form and an empty map for any validation errors.
+	form := snippetCreateForm{
+		Title:            r.PostForm.Get("title"),
+		Files:            filesFromPostForm(r),
+		Expires:          r.PostForm.Get("expires"),
+		ExpiresIn:        r.PostForm.Get("expires_in"),
+		ExpiresAt:        r.PostForm.Get("expires_at"),
+		TimezoneOffset:   timezoneOffset,
+		Visibility:       r.PostForm.Get("visibility"),
+		BurnAfterReading: r.PostForm.Get("burn_after_reading") == "true",
+		Password:         r.PostForm.Get("password"),
+		Encrypted:        r.PostForm.Get("encrypted") == "true",
+		Fork:             r.PostForm.Get("fork"),
+		Tags:             r.PostForm.Get("tags"),
+		Org:              r.PostForm.Get("org"),
+		// FieldErrors: map[string]string{},
+	}
+
+	// Because the Validator type is embedded by the snippetCreateForm struct, we can call CheckField() directly on it to execute our validation checks.
+	// CheckField() will add the provided key and error message to the  FieldErrors map if the check does not evaluate to true.
+	// For example, in the first line here we "check that the form.Title field is not blank".
+	// In the second, we "check that the form.Title field has a maximum character length of 100" and so on.
+	form.CheckField(validator.NotBlank(form.Title), "title", "must not be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "must not be more than 100 characters")
+	checkFiles(&form.Validator, form.Files, form.Encrypted)
+
+	// Tags are optional. They're normalized before they're checked, so "Go, go " is the same as "go".
+	tags := models.ParseTags(form.Tags)
+	form.CheckField(len(tags) <= maxTags, "tags", fmt.Sprintf("must not have more than %d tags", maxTags))
+	for _, tag := range tags {
+		form.CheckField(validator.Matches(tag, models.TagRX), "tags", fmt.Sprintf("%q is not a valid tag -- tags can only contain letters, numbers and hyphens, and must not be more than 30 characters", tag))
+	}
+
+	// If the snippet is a fork, check that the user can still fork the source snippet. It might have expired, or been made private, since the form was shown.
+	var parentID int
+	if form.Fork != "" {
+		source, err := app.forkSource(r, form.Fork)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddNonFieldError("The snippet you're forking is no longer available")
+			form.Fork = ""
+		} else {
+			parentID = source.ID
+		}
+	}
+
+	// Work out when the snippet should expire, checking it against the expiry policy for the user.
+	expires := app.expiryFromForm(&form, app.authenticatedUser(r))
+	// If the snippet is for an organization, check that the user is a member of it. They might have been removed since the form was shown.
+	var orgID int
+	if form.Org != "" {
+		org, err := app.orgs.GetBySlug(form.Org)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+		if err == nil && app.orgRole(r, org.ID) != "" {
+			orgID = org.ID
+		} else {
+			form.AddFieldError("org", "must be an organization you're a member of")
+		}
+	}
+
+	// Use the generic PermittedValue() function instead of the type-specific PermittedInt() function.
+	// Snippets which belong to an organization can be visible to its members only, instead of being private to one user.
+	if form.Org != "" {
+		form.CheckField(validator.PermittedValue(form.Visibility, models.OrgVisibilities...), "visibility", "must be public, unlisted or members only")
+	} else {
+		form.CheckField(validator.PermittedValue(form.Visibility, models.Visibilities...), "visibility", "must be public, unlisted or private")
+	}
+	// The password is optional, but bcrypt can only hash passwords up to 72 bytes long.
+	form.CheckField(len(form.Password) <= 72, "password", "must not be more than 72 bytes long")
+
+	// Use the Valid() method to see if any of the checks failed. If they did, then re-render the template passing in the form in the same way as before.
+	if !form.Valid() {
+		app.renderCreateForm(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	/*
+		// Check that the title value is not blank and is not more than 100 characters long.
+		// If it fails either of those checks, add a message to the errors map using the field name as the key.
+
+		// Update the validation checks so that they operate on the snippetCreateForm instance.
+		if strings.TrimSpace(form.Title) == "" {
+			form.FieldErrors["title"] = "This field cannot be blank"
+		} else if utf8.RuneCountInString(form.Title) > 100 {
+			form.FieldErrors["title"] = "This field cannot be more than 100 characters long"
+		}
+
+		// Check that the content value isn't blank.
+		if strings.TrimSpace(form.Content) == "" {
+			form.FieldErrors["content"] = "This field cannot be blank"
+		}
 
 		// Check the expires value matches one of the permitted values (1, 7 or 365)
 		if form.Expires != 1 && form.Expires != 7 && form.Expires != 365 {
@@ -314,185 +1706,730 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 			return
 		}
 	*/
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	// A public snippet which is burned after reading would be listed on the home page, where anyone could reveal it before the person it was meant for.
+	// So they're always unlisted instead: only people with the link can find them.
+	if form.BurnAfterReading && form.Visibility == models.VisibilityPublic {
+		form.Visibility = models.VisibilityUnlisted
+	}
+
+	snippet := &models.Snippet{
+		Title:            form.Title,
+		Files:            form.Files,
+		Expires:          expires,
+		UserID:           app.authenticatedUser(r).ID,
+		OrgID:            orgID,
+		Visibility:       form.Visibility,
+		BurnAfterReading: form.BurnAfterReading,
+		Encrypted:        form.Encrypted,
+		ParentID:         parentID,
+		Tags:             tags,
+	}
+
+	err = app.snippets.Insert(snippet, form.Password)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Use the Put() method to add a string value ("Snippet successfully created!") and the corresponding key ("flash") to the session data.
+	switch {
+	case snippet.Encrypted:
+		app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created! Keep the full link, including the part after the # -- it holds the only copy of the decryption key.")
+	case snippet.BurnAfterReading:
+		app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created! Share the link below -- it will be deleted the first time it's revealed.")
+	default:
+		app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	}
+
+	// http.Redirect(w, r, fmt.Sprintf("/snippet/view?id=%d", id), http.StatusSeeOther)
+	// Update the redirect path to use the new clean URL format, identifying the snippet by its slug.
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
+
+}
+
+func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
+	// Retrieve the appropriate template set from the cache based on the page name (like 'home.tmpl').
+	// If no entry exists in the cache with the provided name, then create a new error and call the serverError() helper method that we made earlier and return.
+	ts, ok := app.templateCache[page]
+	if !ok {
+		err := fmt.Errorf("the template %s does not exist", page)
+		app.serverError(w, err)
+		return
+	}
+
+	// Initialize a new buffer.
+	buf := new(bytes.Buffer)
+
+	// Write the template to the buffer, instead of straight to the http.ResponseWriter.
+	// If there's an error, call our serverError() helper and then return.
+	err := ts.ExecuteTemplate(buf, "base", data)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// If the template is written to the buffer without any errors,
+	// we are safe to go ahead and write the HTTP status code to http.ResponseWriter.
+	w.WriteHeader(status)
+
+	// Write the contents of the buffer to the http.ResponseWriter.
+	// Note: this is another time where we pass our http.ResponseWriter to a function that takes an io.Writer.
+	buf.WriteTo(w)
+
+	/*
+		err := ts.ExecuteTemplate(w, "base", data)
+		if err != nil {
+			app.serverError(w, err)
+		}
+	*/
+}
+
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	// Invite links include the invite code in the query string.
+	code := r.URL.Query().Get("invite")
+
+	invite, ok := app.signupInvite(w, r, code)
+	if !ok {
+		return
+	}
+
+	// If the invite is for a particular email address, pre-fill the form with it.
+	form := userSignupForm{Invite: code}
+	if invite != nil {
+		form.Email = invite.Email
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Invite = invite
+	app.render(w, http.StatusOK, "signup.tmpl", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	// err := r.ParseForm()
+	// if err != nil {
+	// 	app.clientError(w, http.StatusBadRequest)
+	// 	return
+	// }
+	//  form := userSignupForm{
+	// 	Name: r.PostForm.Get("name"),
+	// 	Email: r.PostForm.Get("email"),
+	// 	Password: r.PostForm.Get("password"),
+	//  }
+
+	// Using third-party package
+	var form userSignupForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Check that the user is allowed to sign up at all, before looking at what they've entered.
+	invite, ok := app.signupInvite(w, r, form.Invite)
+	if !ok {
+		return
+	}
+
+	// Usernames are case-insensitive, so we always store them in lowercase.
+	form.Username = strings.ToLower(strings.TrimSpace(form.Username))
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Username), "username", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Username, validator.UsernameRX), "username", "This field must be 3 to 30 letters, numbers, hyphens or underscores, starting with a letter")
+	form.CheckField(!validator.PermittedValue(form.Username, reservedUsernames...), "username", "This username is reserved")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This filed cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 6), "password", "This filed must be at least 6 characters long")
+
+	// An invite for a particular email address can only be used with that address, so that it can't be passed on to someone else.
+	// Without an invite, the address might have to be at one of the allowed domains.
+	switch {
+	case invite != nil && invite.Email != "":
+		form.CheckField(strings.EqualFold(form.Email, invite.Email), "email", "This field must be the email address you were invited with")
+	case invite == nil && app.registration.mode == registrationDomains:
+		form.CheckField(emailDomainAllowed(form.Email, app.registration.domains), "email", "This field must be an email address at "+strings.Join(app.registration.domains, " or "))
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.Invite = invite
+		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		return
+	}
+
+	// Claim the invite before creating the account, so that two people can't use the same invite at once.
+	if invite != nil {
+		err = app.invites.Claim(invite.ID, form.Email)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.renderSignupClosed(w, r, "This invite has already been used, or has expired.")
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+	}
+
+	// Try to create a new user record in the database. If the email already exists then add an error message to the form and re-display it.
+	// Do the same if the username has already been taken.
+	err = app.users.Insert(form.Name, form.Username, form.Email, form.Password)
+	if err != nil {
+		// The account wasn't created, so the invite can be used again once the form has been corrected.
+		if invite != nil {
+			releaseErr := app.invites.Release(invite.ID)
+			if releaseErr != nil {
+				app.serverError(w, releaseErr)
+				return
+			}
+		}
+
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
+			form.AddFieldError("email", "Email address is already in use")
+		case errors.Is(err, models.ErrDuplicateUsername):
+			form.AddFieldError("username", "Username is already taken")
+		default:
+			app.serverError(w, err)
+			return
+		}
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.Invite = invite
+		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		return
+	}
+
+	// Otherwise add a confirmation flash message to the session confirming that their signup worked.
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+
+	// And redirect the user to the login page.
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+	app.render(w, http.StatusOK, "login.tmpl", data)
+}
+
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	var form userLoginForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	// The login can be either a username or an email address, so we can only check that it isn't blank.
+	form.CheckField(validator.NotBlank(form.Login), "login", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		return
+	}
+
+	// Check whether the credentials are valid. If they're not, add a generic non-field error message and re-display the login page.
+	id, err := app.users.Authenticate(strings.TrimSpace(form.Login), form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddNonFieldError("Username, email or password is incorrect")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		} else if errors.Is(err, models.ErrAccountDisabled) {
+			form.AddNonFieldError("Your account has been disabled")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusForbidden, "login.tmpl", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.startSession(r, id, form.RememberMe)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// The userLoginOIDC handler starts logging in with single sign-on, by sending the user to the identity provider.
+func (app *application) userLoginOIDC(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFound(w)
+		return
+	}
+
+	// The state is checked when the provider sends the user back, so that nobody else can make the callback log the user in to their account.
+	// The nonce is included in the ID token, so that a token issued for one login can't be used for another.
+	state, err := randomToken()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// With PKCE, the code the provider sends back is only any use along with the verifier, which never leaves our server --
+	// the provider only sees a hash of it.
+	verifier := oauth2.GenerateVerifier()
+
+	app.sessionManager.Put(r.Context(), "oidcState", state)
+	app.sessionManager.Put(r.Context(), "oidcNonce", nonce)
+	app.sessionManager.Put(r.Context(), "oidcVerifier", verifier)
+
+	http.Redirect(w, r, app.oidc.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), http.StatusSeeOther)
+}
+
+// The userLoginOIDCCallback handler is where the identity provider sends the user back to once they've logged in.
+func (app *application) userLoginOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFound(w)
+		return
+	}
+
+	// Each login can only be completed once, so we remove the values from the session straight away.
+	state := app.sessionManager.PopString(r.Context(), "oidcState")
+	nonce := app.sessionManager.PopString(r.Context(), "oidcNonce")
+	verifier := app.sessionManager.PopString(r.Context(), "oidcVerifier")
+
+	query := r.URL.Query()
+	if state == "" || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The provider sends an error instead of a code if the user didn't log in, or refused to let us see their details.
+	if query.Get("error") != "" {
+		app.renderLoginError(w, r, http.StatusUnauthorized, "Logging in with "+app.oidc.name+" was cancelled")
+		return
+	}
+
+	token, err := app.oidc.config.Exchange(r.Context(), query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		app.errLog.Printf("oidc: exchanging code: %v", err)
+		app.renderLoginError(w, r, http.StatusUnauthorized, "Logging in with "+app.oidc.name+" failed")
+		return
+	}
+
+	// Check that the ID token was signed by the provider, for us, recently, and for this login.
+	rawIDToken, _ := token.Extra("id_token").(string)
+	idToken, err := app.oidc.verifier.Verify(r.Context(), rawIDToken)
+	if err == nil && subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		err = errors.New("nonce doesn't match")
+	}
+	if err != nil {
+		app.errLog.Printf("oidc: verifying ID token: %v", err)
+		app.renderLoginError(w, r, http.StatusUnauthorized, "Logging in with "+app.oidc.name+" failed")
+		return
+	}
+
+	var claims oidcClaims
+	err = idToken.Claims(&claims)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	id, ok := app.oidcUser(w, r, idToken.Issuer, idToken.Subject, &claims)
+	if !ok {
+		return
+	}
+
+	err = app.startSession(r, id, false)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
-
-	// Use the Put() method to add a string value ("Snippet successfully created!") and the corresponding key ("flash") to the session data.
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
-
-	// http.Redirect(w, r, fmt.Sprintf("/snippet/view?id=%d", id), http.StatusSeeOther)
-	// Update the redirect path to use the new clean URL format.
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
-
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
 }
 
-func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
-	// Retrieve the appropriate template set from the cache based on the page name (like 'home.tmpl').
-	// If no entry exists in the cache with the provided name, then create a new error and call the serverError() helper method that we made earlier and return.
-	ts, ok := app.templateCache[page]
-	if !ok {
-		err := fmt.Errorf("the template %s does not exist", page)
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	err := app.logout(r)
+	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// Initialize a new buffer.
-	buf := new(bytes.Buffer)
+	// Add a flash message to the session to confirm to the user that they've been logged out.
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
 
-	// Write the template to the buffer, instead of straight to the http.ResponseWriter.
-	// If there's an error, call our serverError() helper and then return.
-	err := ts.ExecuteTemplate(buf, "base", data)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	sessions, err := app.sessions.ForUser(userID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// If the template is written to the buffer without any errors,
-	// we are safe to go ahead and write the HTTP status code to http.ResponseWriter.
-	w.WriteHeader(status)
-
-	// Write the contents of the buffer to the http.ResponseWriter.
-	// Note: this is another time where we pass our http.ResponseWriter to a function that takes an io.Writer.
-	buf.WriteTo(w)
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
 
-	/*
-		err := ts.ExecuteTemplate(w, "base", data)
-		if err != nil {
-			app.serverError(w, err)
+	// Work out which of the sessions is the one making this request, so that we can label it in the list.
+	token := app.sessionManager.Token(r.Context())
+	for _, s := range sessions {
+		if s.Token == token {
+			data.CurrentSessionID = s.ID
 		}
-	*/
+	}
+
+	data.CanInvite = app.canInvite(r)
+
+	app.render(w, http.StatusOK, "account.tmpl", data)
 }
 
-func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = userSignupForm{}
-	app.render(w, http.StatusOK, "signup.tmpl", data)
+// The accountInvites handler lists the invites the user has created, with a form to create another one.
+func (app *application) accountInvites(w http.ResponseWriter, r *http.Request) {
+	if !app.canInvite(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	app.renderInvites(w, r, http.StatusOK, inviteForm{})
 }
 
-func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
-	// err := r.ParseForm()
-	// if err != nil {
-	// 	app.clientError(w, http.StatusBadRequest)
-	// 	return
-	// }
-	//  form := userSignupForm{
-	// 	Name: r.PostForm.Get("name"),
-	// 	Email: r.PostForm.Get("email"),
-	// 	Password: r.PostForm.Get("password"),
-	//  }
+func (app *application) accountInviteCreatePost(w http.ResponseWriter, r *http.Request) {
+	if !app.canInvite(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
 
-	// Using third-party package
-	var form userSignupForm
+	var form inviteForm
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This filed cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 6), "password", "This filed must be at least 6 characters long")
+	// The email address is optional. If it's given, only that address can be used to sign up with the invite.
+	form.Email = strings.TrimSpace(form.Email)
+	form.CheckField(form.Email == "" || validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
 
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		app.renderInvites(w, r, http.StatusUnprocessableEntity, form)
 		return
 	}
 
-	// Try to create a new user record in the database. If the email already exists then add an error message to the form and re-display it.
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	invite := &models.Invite{
+		Email:     form.Email,
+		CreatedBy: app.authenticatedUser(r).ID,
+		Expires:   time.Now().Add(inviteLifetime),
+	}
+
+	err = app.invites.Insert(invite)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFieldError("email", "Email address is already in use")
+		app.serverError(w, err)
+		return
+	}
 
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+	app.sessionManager.Put(r.Context(), "flash", "Invite created! Send its signup link to the person you're inviting. It can only be used once.")
+
+	http.Redirect(w, r, "/account/invites", http.StatusSeeOther)
+}
+
+// The accountInviteDeletePost handler deletes one of the user's unused invites, so that it can't be used to sign up.
+func (app *application) accountInviteDeletePost(w http.ResponseWriter, r *http.Request) {
+	if !app.canInvite(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Only unused invites which the user created can be deleted.
+	err = app.invites.Delete(id, app.authenticatedUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusBadRequest)
 		} else {
 			app.serverError(w, err)
 		}
 		return
 	}
 
-	// Otherwise add a confirmation flash message to the session confirming that their signup worked.
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+	app.sessionManager.Put(r.Context(), "flash", "The invite has been deleted.")
 
-	// And redirect the user to the login page.
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	http.Redirect(w, r, "/account/invites", http.StatusSeeOther)
 }
 
-func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+// The accountSnippets handler lists all of the logged-in user's snippets, a page at a time.
+// Unlike their public profile, this includes their unlisted, private and expired snippets.
+func (app *application) accountSnippets(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	page, err := pageFromQuery(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippets, total, err := app.snippets.AllByUser(userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if page > 1 && len(snippets) == 0 {
+		app.notFound(w)
+		return
+	}
+
 	data := app.newTemplateData(r)
-	data.Form = userLoginForm{}
-	app.render(w, http.StatusOK, "login.tmpl", data)
+	data.Snippets = snippets
+	data.Pagination = newPagination("/account/snippets", page, pageSize, total)
+
+	app.render(w, http.StatusOK, "account_snippets.tmpl", data)
 }
 
-func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
-	var form userLoginForm
-	err := app.decodePostForm(r, &form)
+func (app *application) accountSessionLogoutPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Check whether the credentials are valid. If they're not, add a generic non-field error message and re-display the login page.
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	// Look up the session, making sure that it belongs to the current user.
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	session, err := app.sessions.Get(id, userID)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("Email or password is incorrect")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
 		} else {
 			app.serverError(w, err)
 		}
 		return
 	}
 
-	// Use the RenewToken() method on the current session to change the session ID.
-	// It's good practice to generate a new session ID when the authentication state or privilege levels changes for the user (e.g. login and logout operations).
-	err = app.sessionManager.RenewToken(r.Context())
+	// If the user is logging out the device they're currently using, then this is just a normal logout.
+	if session.Token == app.sessionManager.Token(r.Context()) {
+		app.userLogoutPost(w, r)
+		return
+	}
+
+	err = app.revokeSession(session.Token)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
-	// Add the ID of the current user to the session, so that they are now 'logged in'.
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+
+	app.sessionManager.Put(r.Context(), "flash", "The device has been logged out.")
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
 }
 
-func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	// Use the RenewToken() method on the current session to change the session ID again.
-	err := app.sessionManager.RenewToken(r.Context())
+func (app *application) accountSessionLogoutAllPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	sessions, err := app.sessions.ForUser(userID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// Remove the authenticatedUserID from the session data so that the user is 'logged out'.
-	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	// Revoke every other session belonging to the user, and then log out the current one as normal.
+	token := app.sessionManager.Token(r.Context())
+	for _, s := range sessions {
+		if s.Token == token {
+			continue
+		}
 
-	// Add a flash message to the session to confirm to the user that they've been logged out.
-	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
+		err = app.revokeSession(s.Token)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	err = app.logout(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out on all devices.")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// Define a revisionDiff struct to hold the changes between two revisions of a snippet, for the diff page.
+// From is nil when diffing against the start of the snippet's history. Files holds the changes to each file which is different in the two revisions.
+type revisionDiff struct {
+	From  *models.Revision
+	To    *models.Revision
+	View  string
+	Files []*fileDiff
+}
+
+// Define a fileDiff struct to hold the changes to a single file between two revisions. Depending on the view,
+// either Hunks (for a "unified" diff) or Rows (for a "split" one) is populated.
+type fileDiff struct {
+	Name    string
+	Added   bool // true if the file is only in the newer revision
+	Removed bool // true if the file is only in the older revision
+	Hunks   []diff.Hunk
+	Rows    []diff.Row
+	// TooDifferent is true if the file has changed too much to show the changes.
+	TooDifferent bool
+}
+
+// Define an instanceStats struct to hold the counts shown on the admin dashboard.
+type instanceStats struct {
+	Users         int
+	DisabledUsers int
+	Snippets      int
+	LiveSnippets  int
+}
+
+func (app *application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	var stats instanceStats
+	var err error
+
+	stats.Users, stats.DisabledUsers, err = app.users.Count()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	stats.Snippets, stats.LiveSnippets, err = app.snippets.Count()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Stats = &stats
+	app.render(w, http.StatusOK, "admin.tmpl", data)
+}
+
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := app.users.All()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Users = users
+	app.render(w, http.StatusOK, "admin_users.tmpl", data)
+}
+
+func (app *application) adminUserDisablePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	disabled, err := strconv.ParseBool(r.PostForm.Get("disabled"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Don't let admins lock themselves out by disabling their own account.
+	if id == app.authenticatedUser(r).ID {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.users.SetDisabled(id, disabled)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if disabled {
+		app.sessionManager.Put(r.Context(), "flash", "The account has been disabled.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "The account has been enabled.")
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminSnippets(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Query = r.URL.Query().Get("q")
+
+	// Only search once the admin has entered something to search for.
+	if validator.NotBlank(data.Query) {
+		snippets, err := app.snippets.Search(data.Query)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Snippets = snippets
+	}
+
+	app.render(w, http.StatusOK, "admin_snippets.tmpl", data)
+}
+
+func (app *application) adminSnippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.snippets.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The snippet has been deleted.")
+
+	// Send the admin back to the search results they came from.
+	http.Redirect(w, r, "/admin/snippets?q="+url.QueryEscape(r.PostForm.Get("q")), http.StatusSeeOther)
+}
+
 func ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"archive/zip"
 	// "bytes"
 	// "io"
 	// "log"
 	"net/http"
 	// "net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"snippetbox.linze.me/internal/assert"
 )
@@ -87,22 +91,2072 @@ func TestSnippetView(t *testing.T) {
 	defer ts.Close()
 
 	// Set up some table-driven tests to check the responses sent by our application for different URLs.
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantBody     string
+		wantLocation string
+	}{{name: "Valid slug", urlPath: "/snippet/view/b6dL_k3fQz1x", wantCode: http.StatusOK, wantBody: "An old silent pond..."}, {name: "Non-existent slug", urlPath: "/snippet/view/AAAAAAAAAAAA", wantCode: http.StatusNotFound},
+		{name: "Malformed slug", urlPath: "/snippet/view/b6dL_k3fQz1", wantCode: http.StatusNotFound},
+		{name: "Legacy ID", urlPath: "/snippet/view/1", wantCode: http.StatusMovedPermanently, wantLocation: "/snippet/view/b6dL_k3fQz1x"},
+		{name: "Non-existent ID", urlPath: "/snippet/view/2", wantCode: http.StatusNotFound}, {name: "Negative ID", urlPath: "/snippet/view/-1", wantCode: http.StatusNotFound},
+		{name: "Decimal ID", urlPath: "/snippet/view/1.23", wantCode: http.StatusNotFound}, {name: "String ID", urlPath: "/snippet/view/foo", wantCode: http.StatusNotFound}, {name: "Empty ID", urlPath: "/snippet/view/", wantCode: http.StatusNotFound},
+		{name: "Private slug", urlPath: "/snippet/view/Wnt3r-F0rest", wantCode: http.StatusNotFound},
+		{name: "Private legacy ID", urlPath: "/snippet/view/3", wantCode: http.StatusNotFound},
+		{name: "Slug with a sign", urlPath: "/snippet/view/-12345678901", wantCode: http.StatusOK, wantBody: "Below zero"}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAccountView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/account")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Authenticated", func(t *testing.T) {
+		ts.login(t, "alice@email.com")
+
+		code, _, body := ts.get(t, "/account")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Mozilla/5.0 (Mock Browser)")
+		assert.StringContains(t, body, "Log out this device")
+	})
+}
+
+func TestUserLoginPostRememberMe(t *testing.T) {
+	tests := []struct {
+		name        string
+		remember    string
+		wantPersist bool
+	}{
+		{name: "Session cookie", remember: "", wantPersist: false},
+		{name: "Remember me", remember: "true", wantPersist: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/user/login")
+
+			form := url.Values{}
+			form.Add("login", "alice@email.com")
+			form.Add("password", "pa$$word")
+			form.Add("remember", tt.remember)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, _ := ts.postForm(t, "/user/login", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			// A persistent cookie is one with a Max-Age attribute set.
+			var persist bool
+			for _, cookie := range headers.Values("Set-Cookie") {
+				if strings.HasPrefix(cookie, "session=") && strings.Contains(cookie, "Max-Age=") {
+					persist = true
+				}
+			}
+			assert.Equal(t, persist, tt.wantPersist)
+		})
+	}
+}
+
+func TestAdminDashboard(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Unauthenticated", wantCode: http.StatusSeeOther},
+		{name: "Regular user", email: "alice@email.com", wantCode: http.StatusForbidden},
+		{name: "Admin", email: "bob@email.com", wantCode: http.StatusOK, wantBody: "Live snippets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.email != "" {
+				ts.login(t, tt.email)
+			}
+
+			code, _, body := ts.get(t, "/admin")
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetViewPrivate(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Owner", email: "alice@email.com", wantCode: http.StatusOK, wantBody: "Over the wintry forest"},
+		{name: "Other user", email: "bob@email.com", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.login(t, tt.email)
+
+			code, _, body := ts.get(t, "/snippet/view/Wnt3r-F0rest")
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetBurnAfterReading(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Viewing the snippet should show the interstitial page, without revealing the content.
+	code, headers, body := ts.get(t, "/snippet/view/Burn-Aft3r-R")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Cache-Control"), "no-store")
+	assert.StringContains(t, body, "Reveal snippet")
+	assert.Equal(t, strings.Contains(body, "correct horse battery staple"), false)
+
+	// Revealing the snippet should show the content.
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, body = ts.postForm(t, "/snippet/reveal/Burn-Aft3r-R", form)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "correct horse battery staple")
+	assert.StringContains(t, body, "This snippet has now been deleted")
+}
+
+func TestSnippetUnlock(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Viewing the snippet should show the unlock form, without revealing the title or content.
+	code, headers, body := ts.get(t, "/snippet/view/Pr0tected-55")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Cache-Control"), "no-store")
+	assert.StringContains(t, body, "Unlock snippet")
+	assert.Equal(t, strings.Contains(body, "Staging server"), false)
+	assert.Equal(t, strings.Contains(body, "ssh deploy@staging.example.com"), false)
+
+	// The raw content shouldn't be available either.
+	code, _, _ = ts.get(t, "/snippet/raw/Pr0tected-55")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	csrfToken := extractCSRFToken(t, body)
+
+	// A wrong password should re-display the form with an error.
+	form := url.Values{}
+	form.Add("password", "wrong-password")
+	form.Add("csrf_token", csrfToken)
+
+	code, _, body = ts.postForm(t, "/snippet/unlock/Pr0tected-55", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "The password is incorrect")
+
+	// The correct password should redirect back to the snippet, which is then visible for the rest of the session.
+	form.Set("password", "hunter22")
+
+	code, headers, _ = ts.postForm(t, "/snippet/unlock/Pr0tected-55", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/view/Pr0tected-55")
+
+	code, _, body = ts.get(t, "/snippet/view/Pr0tected-55")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "ssh deploy@staging.example.com")
+
+	code, headers, body = ts.get(t, "/snippet/raw/Pr0tected-55")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Type"), "text/plain; charset=utf-8")
+	assert.Equal(t, body, "ssh deploy@staging.example.com")
+}
+
+func TestSnippetUnlockOwner(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The owner of a protected snippet never needs to enter its password.
+	ts.login(t, "bob@email.com")
+
+	code, _, body := ts.get(t, "/snippet/view/Pr0tected-55")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "ssh deploy@staging.example.com")
+}
+
+func TestSnippetCreatePostEncrypted(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@email.com")
+
+	_, _, body := ts.get(t, "/snippet/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		content  string
+		wantCode int
+	}{
+		{
+			name:     "Ciphertext",
+			content:  "q9Wl2yV0c1xg3H7k.mH3s1cXv0yqkz9Yf2v8t0QnB1aL4wE5r",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Plaintext",
+			content:  "The server should never see this",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing nonce",
+			content:  "mH3s1cXv0yqkz9Yf2v8t0QnB1aL4wE5r",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Encrypted notes")
+			form.Add("content", tt.content)
+			form.Add("expires", "7d")
+			form.Add("visibility", "unlisted")
+			form.Add("encrypted", "true")
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			// The ciphertext shouldn't be put back in the textarea if the form is re-displayed.
+			if tt.wantCode == http.StatusUnprocessableEntity {
+				assert.Equal(t, strings.Contains(body, tt.content), false)
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePostBurnPublic(t *testing.T) {
+	tests := []struct {
+		name     string
+		burn     bool
+		wantHome bool
+	}{
+		{"Public", false, true},
+		{"Public and burned after reading", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.login(t, "alice@email.com")
+			_, _, body := ts.get(t, "/snippet/create")
+
+			form := url.Values{}
+			form.Add("title", "Launch codes")
+			form.Add("content", "0000")
+			form.Add("expires", "7d")
+			form.Add("visibility", "public")
+			if tt.burn {
+				form.Add("burn_after_reading", "true")
+			}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, _ := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			// Snippets which are burned after reading are made unlisted, so nobody can find them on the home page and reveal them.
+			_, _, body = ts.get(t, "/")
+			assert.Equal(t, strings.Contains(body, "Launch codes"), tt.wantHome)
+		})
+	}
+}
+
+func TestSnippetViewEncrypted(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/snippet/view/Encrypt3d-66")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `data-ciphertext="q9Wl2yV0c1xg3H7k.mH3s1cXv0yqkz9Yf2v8t0QnB1aL4wE5r"`)
+	assert.StringContains(t, body, `<script src="/static/js/crypto.js"`)
+
+	// The decryption script should only be loaded for encrypted snippets.
+	_, _, body = ts.get(t, "/snippet/view/b6dL_k3fQz1x")
+	assert.Equal(t, strings.Contains(body, "crypto.js"), false)
+}
+
+func TestSnippetCreatePostExpiry(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	future := time.Now().UTC().Add(48 * time.Hour).Format("2006-01-02T15:04")
+	past := time.Now().UTC().Add(-48 * time.Hour).Format("2006-01-02T15:04")
+	tooFar := time.Now().UTC().Add(400 * 24 * time.Hour).Format("2006-01-02T15:04")
+
+	tests := []struct {
+		name      string
+		email     string
+		expires   string
+		expiresIn string
+		expiresAt string
+		wantCode  int
+		wantBody  string
+	}{
+		{name: "Preset", email: "alice@email.com", expires: "10m", wantCode: http.StatusSeeOther},
+		{name: "Unknown preset", email: "alice@email.com", expires: "1y", wantCode: http.StatusUnprocessableEntity},
+		{name: "Custom duration", email: "alice@email.com", expires: "duration", expiresIn: "90m", wantCode: http.StatusSeeOther},
+		{name: "Invalid duration", email: "alice@email.com", expires: "duration", expiresIn: "soon", wantCode: http.StatusUnprocessableEntity},
+		{name: "Duration over maximum", email: "alice@email.com", expires: "duration", expiresIn: "53w", wantCode: http.StatusUnprocessableEntity},
+		{name: "Date", email: "alice@email.com", expires: "date", expiresAt: future, wantCode: http.StatusSeeOther},
+		{name: "Date in the past", email: "alice@email.com", expires: "date", expiresAt: past, wantCode: http.StatusUnprocessableEntity},
+		{name: "Date over maximum", email: "alice@email.com", expires: "date", expiresAt: tooFar, wantCode: http.StatusUnprocessableEntity},
+		{name: "Never", email: "alice@email.com", expires: "never", wantCode: http.StatusUnprocessableEntity},
+		{name: "Never as admin", email: "bob@email.com", expires: "never", wantCode: http.StatusSeeOther},
+		{name: "Date over maximum as admin", email: "bob@email.com", expires: "date", expiresAt: tooFar, wantCode: http.StatusSeeOther},
+		{name: "Longest duration as admin", email: "bob@email.com", expires: "duration", expiresIn: "3650d", wantCode: http.StatusSeeOther},
+		{name: "Duration over the limit as admin", email: "bob@email.com", expires: "duration", expiresIn: "3651d", wantCode: http.StatusUnprocessableEntity, wantBody: "too far in the future"},
+		{name: "Overflowing duration as admin", email: "bob@email.com", expires: "duration", expiresIn: "999999w", wantCode: http.StatusUnprocessableEntity, wantBody: "too far in the future"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.login(t, tt.email)
+
+			_, _, body := ts.get(t, "/snippet/create")
+
+			form := url.Values{}
+			form.Add("title", "O snail")
+			form.Add("content", "Climb Mount Fuji")
+			form.Add("expires", tt.expires)
+			form.Add("expires_in", tt.expiresIn)
+			form.Add("expires_at", tt.expiresAt)
+			form.Add("visibility", "public")
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestSnippetCreateExpiryOptions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Only users who are exempt from the maximum expiry period should be offered "Never".
+	ts.login(t, "alice@email.com")
+	_, _, body := ts.get(t, "/snippet/create")
+	assert.Equal(t, strings.Contains(body, `value="never"`), false)
+
+	ts.login(t, "bob@email.com")
+	_, _, body = ts.get(t, "/snippet/create")
+	assert.StringContains(t, body, `value="never"`)
+}
+
+func TestSnippetEdit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Only the owner of a snippet can edit it.
+	ts.login(t, "bob@email.com")
+	code, _, _ := ts.get(t, "/snippet/edit/b6dL_k3fQz1x")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	ts.login(t, "alice@email.com")
+	code, _, body := ts.get(t, "/snippet/edit/b6dL_k3fQz1x")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "An old silent pond...")
+
+	// Snippets which are burned after reading can't be edited, even by their owner.
+	code, _, _ = ts.get(t, "/snippet/edit/Burn-Aft3r-R")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	form := url.Values{}
+	form.Add("title", "An old silent pond")
+	form.Add("content", "")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ = ts.postForm(t, "/snippet/edit/b6dL_k3fQz1x", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	form.Set("content", "An old silent pond...\nA frog jumps into the pond")
+	code, headers, _ := ts.postForm(t, "/snippet/edit/b6dL_k3fQz1x", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/view/b6dL_k3fQz1x")
+}
+
+func TestSnippetEditMultiFile(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Every file in the snippet can be edited.
+	ts.login(t, "alice@email.com")
+	code, _, body := ts.get(t, "/snippet/edit/Mult1-F1les8")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `value="Dockerfile"`)
+	assert.StringContains(t, body, "addr: :4000")
+	assert.StringContains(t, body, `value="run.sh"`)
+
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		files    [][2]string // the name and content of each file
+		wantCode int
+		wantBody string
+	}{
+		{"Changed files", [][2]string{{"Dockerfile", "FROM golang:1.22"}, {"config.yaml", "addr: :4000"}}, http.StatusSeeOther, ""},
+		{"Duplicate names", [][2]string{{"Dockerfile", "FROM golang:1.22"}, {"Dockerfile", "addr: :4000"}}, http.StatusUnprocessableEntity, "must be different from the other files"},
+		{"Blank file", [][2]string{{"Dockerfile", "FROM golang:1.22"}, {"config.yaml", ""}}, http.StatusUnprocessableEntity, "must not be blank"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Deployment")
+			for _, file := range tt.files {
+				form.Add("filename", file[0])
+				form.Add("language", "")
+				form.Add("content", file[1])
+			}
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/snippet/edit/Mult1-F1les8", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetHistory(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/snippet/view/b6dL_k3fQz1x/history")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "#2")
+	assert.StringContains(t, body, "#1")
+	assert.StringContains(t, body, "Alice")
+
+	// Restoring isn't offered to users who can't edit the snippet.
+	assert.Equal(t, strings.Contains(body, "Restore"), false)
+
+	// Burned snippets have no history, since showing it would reveal them.
+	code, _, _ = ts.get(t, "/snippet/view/Burn-Aft3r-R/history")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// Password-protected snippets must be unlocked first.
+	code, headers, _ := ts.get(t, "/snippet/view/Pr0tected-55/history")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/view/Pr0tected-55")
+}
+
+func TestSnippetDiff(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "Latest change",
+			urlPath:  "/snippet/view/b6dL_k3fQz1x/diff",
+			wantCode: http.StatusOK,
+			wantBody: []string{"@@ -1,1 &#43;1,1 @@", "- An old pond...", "&#43; An old silent pond...", "Title changed from"},
+		},
+		{
+			name:     "Side by side",
+			urlPath:  "/snippet/view/b6dL_k3fQz1x/diff?from=11&to=12&view=split",
+			wantCode: http.StatusOK,
+			wantBody: []string{`<td class="delete"><pre>An old pond...</pre></td>`, `<td class="insert"><pre>An old silent pond...</pre></td>`},
+		},
+		{
+			name:     "First revision",
+			urlPath:  "/snippet/view/b6dL_k3fQz1x/diff?to=11",
+			wantCode: http.StatusOK,
+			wantBody: []string{"@@ -0,0 &#43;1,1 @@", "&#43; An old pond..."},
+		},
+		{
+			name:     "Multiple files",
+			urlPath:  "/snippet/view/Mult1-F1les8/diff",
+			wantCode: http.StatusOK,
+			wantBody: []string{"Dockerfile", "- FROM golang:1.20", "&#43; FROM golang:1.21", "config.yaml", "(added)", "&#43; addr: :4000", "notes.txt", "(removed)", "- Remember to add a config file"},
+		},
+		{
+			name:     "Unknown revision",
+			urlPath:  "/snippet/view/b6dL_k3fQz1x/diff?to=99",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid revision",
+			urlPath:  "/snippet/view/b6dL_k3fQz1x/diff?from=foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	// Note that html/template escapes "+" characters as "&#43;".
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+		})
+	}
+}
+
+func TestSnippetRestorePost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@email.com")
+
+	_, _, body := ts.get(t, "/snippet/view/b6dL_k3fQz1x/history")
+	assert.StringContains(t, body, "Restore")
+
+	form := url.Values{}
+	form.Add("revision", "11")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, headers, _ := ts.postForm(t, "/snippet/restore/b6dL_k3fQz1x", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/view/b6dL_k3fQz1x/history")
+
+	form.Set("revision", "99")
+	code, _, _ = ts.postForm(t, "/snippet/restore/b6dL_k3fQz1x", form)
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// Multi-file snippets can be restored too.
+	form.Set("revision", "15")
+	code, headers, _ = ts.postForm(t, "/snippet/restore/Mult1-F1les8", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/view/Mult1-F1les8/history")
+}
+
+func TestSnippetFork(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The view page should link to the snippet's forks, and forks should link back to their parent.
+	_, _, body := ts.get(t, "/snippet/view/b6dL_k3fQz1x")
+	assert.StringContains(t, body, `<a href="/snippet/create?fork=b6dL_k3fQz1x">Fork</a>`)
+	assert.StringContains(t, body, `<a href="/snippet/view/F0rked-Snip7">A frog jumps in</a>`)
+
+	_, _, body = ts.get(t, "/snippet/view/F0rked-Snip7")
+	assert.StringContains(t, body, `forked from <a href="/snippet/view/b6dL_k3fQz1x">#b6dL_k3fQz1x</a>`)
+
+	ts.login(t, "alice@email.com")
+
+	// Forking should pre-fill the create form with the source snippet.
+	code, _, body := ts.get(t, "/snippet/create?fork=b6dL_k3fQz1x")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `<input type="hidden" name="fork" value="b6dL_k3fQz1x">`)
+	assert.StringContains(t, body, "An old silent pond...")
+
+	// Snippets which are burned after reading can't be forked.
+	code, _, _ = ts.get(t, "/snippet/create?fork=Burn-Aft3r-R")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	form := url.Values{}
+	form.Add("title", "An old silent pond")
+	form.Add("content", "An old silent pond...\nA frog jumps into the pond")
+	form.Add("expires", "7d")
+	form.Add("visibility", "public")
+	form.Add("fork", "b6dL_k3fQz1x")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ = ts.postForm(t, "/snippet/create", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	// Forking a snippet which isn't available should re-display the form with an error.
+	form.Set("fork", "Burn-Aft3r-R")
+	code, _, body = ts.postForm(t, "/snippet/create", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "no longer available")
+}
+
+func TestSnippetMultiFile(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Each file in the snippet should be shown with its name.
+	code, _, body := ts.get(t, "/snippet/view/Mult1-F1les8")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Dockerfile")
+	assert.StringContains(t, body, "config.yaml")
+	assert.StringContains(t, body, "run.sh")
+
+	// The raw endpoint should serve a single file by name.
+	code, _, body = ts.get(t, "/snippet/raw/Mult1-F1les8?file=config.yaml")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "addr: :4000")
+
+	code, _, _ = ts.get(t, "/snippet/raw/Mult1-F1les8?file=missing.txt")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// The download should be a zip archive containing every file.
+	code, header, body := ts.get(t, "/snippet/download/Mult1-F1les8")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "application/zip")
+
+	archive, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, strings.Join(names, ","), "Dockerfile,config.yaml,run.sh")
+}
+
+func TestSnippetCreatePostFiles(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@email.com")
+
+	_, _, body := ts.get(t, "/snippet/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name      string
+		filenames []string
+		wantCode  int
+	}{
+		{"Valid", []string{"main.go", "go.mod"}, http.StatusSeeOther},
+		{"Unnamed", []string{"", ""}, http.StatusSeeOther},
+		{"Duplicate names", []string{"main.go", "main.go"}, http.StatusUnprocessableEntity},
+		{"Slash in name", []string{"cmd/main.go", "go.mod"}, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "A Go program")
+			for _, name := range tt.filenames {
+				form.Add("filename", name)
+				form.Add("language", "")
+				form.Add("content", "package main")
+			}
+			form.Add("expires", "7d")
+			form.Add("visibility", "public")
+			form.Add("csrf_token", csrfToken)
+
+			code, _, _ := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestTagView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "Tagged snippets",
+			urlPath:  "/tags/haiku",
+			wantCode: http.StatusOK,
+			wantBody: []string{"An old silent pond", "A frog jumps in"},
+		},
+		{
+			name:     "Unused tag",
+			urlPath:  "/tags/prose",
+			wantCode: http.StatusOK,
+			wantBody: []string{"There aren't any snippets with this tag."},
+		},
+		{
+			name:     "Invalid tag",
+			urlPath:  "/tags/Not_A_Tag",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Page beyond the end",
+			urlPath:  "/tags/haiku?page=2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid page",
+			urlPath:  "/tags/haiku?page=0",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Last page allowed",
+			urlPath:  "/tags/haiku?page=100000",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Page too large",
+			urlPath:  "/tags/haiku?page=999999999999999999",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+		})
+	}
+}
+
+func TestHomeTags(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/")
+	assert.Equal(t, code, http.StatusOK)
+
+	// The latest snippets should show their tags, and the tag cloud should weight tags by how often they're used.
+	assert.StringContains(t, body, `<a href="/tags/poetry">poetry</a>`)
+	assert.StringContains(t, body, `<a href="/tags/haiku" class="weight-5" title="2 snippets">haiku</a>`)
+	assert.StringContains(t, body, `<a href="/tags/poetry" class="weight-3" title="1 snippet">poetry</a>`)
+}
+
+func TestSnippetCreatePostTags(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@email.com")
+
+	_, _, body := ts.get(t, "/snippet/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		tags     string
+		wantCode int
+		wantBody string
+	}{
+		{"No tags", "", http.StatusSeeOther, ""},
+		{"Valid tags", "Go, http ,go,, web-dev", http.StatusSeeOther, ""},
+		{"Invalid tag", "go, c++", http.StatusUnprocessableEntity, "is not a valid tag"},
+		{"Too many tags", "a, b, c, d, e, f", http.StatusUnprocessableEntity, "must not have more than 5 tags"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "A Go program")
+			form.Add("content", "package main")
+			form.Add("tags", tt.tags)
+			form.Add("expires", "7d")
+			form.Add("visibility", "public")
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetViewMarkdown(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/snippet/view/Markd0wn-N09")
+	assert.Equal(t, code, http.StatusOK)
+
+	// The Markdown should be rendered, with its code block highlighted and its script removed.
+	assert.StringContains(t, body, `<div class="markdown"><h1>Restarting</h1>`)
+	assert.StringContains(t, body, `<pre class="chroma">`)
+	assert.StringContains(t, body, `<button type="button" class="toggle-source" hidden>Source</button>`)
+	if strings.Contains(body, "<script>alert(1)</script>") {
+		t.Errorf("expected the script to be removed from the rendered Markdown")
+	}
+
+	// The raw endpoint still serves the source.
+	code, _, body = ts.get(t, "/snippet/raw/Markd0wn-N09")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "# Restarting")
+}
+
+func TestUserProfile(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/u/alice")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<h2>Alice</h2>")
+	assert.StringContains(t, body, "An old silent pond")
+
+	// Only live, public snippets are shown on a profile.
+	for _, hidden := range []string{"Over the wintry forest", "Database password", "Yesterday&#39;s news"} {
+		if strings.Contains(body, hidden) {
+			t.Errorf("expected profile not to contain %q", hidden)
+		}
+	}
+
+	for _, urlPath := range []string{"/u/99", "/u/nobody", "/u/alice?page=2"} {
+		code, _, _ = ts.get(t, urlPath)
+		assert.Equal(t, code, http.StatusNotFound)
+	}
+}
+
+func TestAccountSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, _ := ts.get(t, "/account/snippets")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	ts.login(t, "alice@email.com")
+
+	// The user's own list includes their private and expired snippets, but not anyone else's.
+	code, _, body := ts.get(t, "/account/snippets")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Over the wintry forest")
+	assert.StringContains(t, body, "<td>Yesterday&#39;s news</td>")
+	assert.StringContains(t, body, "<td>Expired</td>")
+	if strings.Contains(body, "Staging server") {
+		t.Errorf("expected another user's snippet not to be listed")
+	}
+
+	// Alice created a members-only snippet for Bobco, but she has left it, so she can't see it any more.
+	assert.StringContains(t, body, "Team runbook")
+	assert.Equal(t, strings.Contains(body, "Old Bobco notes"), false)
+}
+
+func TestUserSignupPost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/signup")
+	csrfToken := extractCSRFToken(t, body)
+
+	const (
+		validName     = "Carol"
+		validUsername = "carol"
+		validEmail    = "carol@example.com"
+		validPassword = "validPa$$word"
+	)
+
+	tests := []struct {
+		name     string
+		username string
+		email    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Valid submission", username: validUsername, email: validEmail, wantCode: http.StatusSeeOther},
+		{name: "Mixed case username", username: " Carol ", email: validEmail, wantCode: http.StatusSeeOther},
+		{name: "Blank username", username: "", email: validEmail, wantCode: http.StatusUnprocessableEntity, wantBody: "This field cannot be blank"},
+		{name: "Short username", username: "cj", email: validEmail, wantCode: http.StatusUnprocessableEntity, wantBody: "3 to 30 letters"},
+		{name: "Username with @", username: "carol@example", email: validEmail, wantCode: http.StatusUnprocessableEntity, wantBody: "3 to 30 letters"},
+		{name: "Numeric username", username: "12345", email: validEmail, wantCode: http.StatusUnprocessableEntity, wantBody: "starting with a letter"},
+		{name: "Reserved username", username: "admin", email: validEmail, wantCode: http.StatusUnprocessableEntity, wantBody: "This username is reserved"},
+		{name: "Duplicate username", username: "alice", email: validEmail, wantCode: http.StatusUnprocessableEntity, wantBody: "Username is already taken"},
+		{name: "Duplicate email", username: validUsername, email: "dupe@email.com", wantCode: http.StatusUnprocessableEntity, wantBody: "Email address is already in use"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", validName)
+			form.Add("username", tt.username)
+			form.Add("email", tt.email)
+			form.Add("password", validPassword)
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/user/signup", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUserLoginPostUsername(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("login", "alice")
+	form.Add("password", "wrong password")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, body := ts.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "Username, email or password is incorrect")
+
+	// Logging in with a username works just like logging in with an email address.
+	ts.login(t, "alice")
+
+	code, _, body = ts.get(t, "/account")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `<a href="/u/alice">your public profile</a>`)
+}
+
+func TestUserProfileLegacyURL(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"User ID", "/u/2", http.StatusMovedPermanently, "/u/bob"},
+		{"Mixed case username", "/u/Bob", http.StatusMovedPermanently, "/u/bob"},
+		{"Unknown user ID", "/u/99", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, _ := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestSnippetStarPost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users don't get a star button.
+	_, _, body := ts.get(t, "/snippet/view/b6dL_k3fQz1x")
+	assert.StringContains(t, body, "2 stars")
+	if strings.Contains(body, "/snippet/star/") {
+		t.Errorf("expected no star button for anonymous users")
+	}
+
+	ts.login(t, "alice@email.com")
+
+	// Alice has already starred mockSnippet, so she should be offered the chance to unstar it.
+	_, _, body = ts.get(t, "/snippet/view/b6dL_k3fQz1x")
+	assert.StringContains(t, body, `<input type="hidden" name="starred" value="false">`)
+
+	_, _, body = ts.get(t, "/snippet/view/Mult1-F1les8")
+	assert.StringContains(t, body, `<input type="hidden" name="starred" value="true">`)
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		slug     string
+		starred  string
+		wantCode int
+	}{
+		{"Star", "Mult1-F1les8", "true", http.StatusSeeOther},
+		{"Unstar", "b6dL_k3fQz1x", "false", http.StatusSeeOther},
+		{"Invalid value", "b6dL_k3fQz1x", "maybe", http.StatusBadRequest},
+		{"Burn after reading", "Burn-Aft3r-R", "true", http.StatusNotFound},
+		{"Own private snippet", "Wnt3r-F0rest", "true", http.StatusSeeOther},
+		{"Missing snippet", "Miss1ng-Snip", "true", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("starred", tt.starred)
+			form.Add("csrf_token", csrfToken)
+
+			code, _, _ := ts.postForm(t, "/snippet/star/"+tt.slug, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestUserStarred(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anyone can see the public snippets Alice has starred, but not the unlisted ones.
+	code, _, body := ts.get(t, "/u/alice/starred")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "An old silent pond")
+	assert.StringContains(t, body, "A frog jumps in")
+	if strings.Contains(body, "Staging server") {
+		t.Errorf("expected unlisted starred snippets to be hidden from other users")
+	}
+
+	// Alice can see all of her starred snippets, except a members-only snippet of an organization she has left.
+	ts.login(t, "alice@email.com")
+	_, _, body = ts.get(t, "/u/alice/starred")
+	assert.StringContains(t, body, "Staging server")
+	assert.Equal(t, strings.Contains(body, "Old Bobco notes"), false)
+
+	code, _, _ = ts.get(t, "/snippet/view/L3ft-0rgSn13")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, headers, _ := ts.get(t, "/u/1/starred")
+	assert.Equal(t, code, http.StatusMovedPermanently)
+	assert.Equal(t, headers.Get("Location"), "/u/alice/starred")
+}
+
+func TestHomeMostStarred(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Most Starred This Week")
+	assert.StringContains(t, body, "A frog jumps in")
+}
+
+func TestSnippetViewComments(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users can read the comments, but are asked to log in to write one.
+	code, _, body := ts.get(t, "/snippet/view/b6dL_k3fQz1x")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Should this be <strong>five</strong> syllables?")
+	assert.StringContains(t, body, "I like the <code>frog</code>.")
+	assert.StringContains(t, body, `<a href="/user/login">Log in</a> to comment.`)
+
+	// Bob's reply should come straight after the comment it replies to, indented, and before his separate comment.
+	reply := strings.Index(body, `<div class="comment depth-1" id="comment-2">`)
+	if reply < strings.Index(body, `id="comment-1"`) || reply > strings.Index(body, `id="comment-3"`) {
+		t.Errorf("expected the comments to be in thread order")
+	}
+
+	// Bob can edit his own comments, but not Alice's.
+	ts.login(t, "bob@email.com")
+	_, _, body = ts.get(t, "/snippet/view/b6dL_k3fQz1x")
+	assert.StringContains(t, body, `<a href="/comment/edit/2">Edit</a>`)
+	assert.StringContains(t, body, `<a href="/comment/edit/3">Edit</a>`)
+	if strings.Contains(body, `<a href="/comment/edit/1">Edit</a>`) {
+		t.Errorf("expected no edit link for another user's comment")
+	}
+}
+
+func TestSnippetCommentPost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	// Anonymous users are sent to the login page.
+	form := url.Values{}
+	form.Add("content", "Hello")
+	form.Add("csrf_token", csrfToken)
+	code, headers, _ := ts.postForm(t, "/snippet/comment/b6dL_k3fQz1x", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	ts.login(t, "bob@email.com")
+	_, _, body = ts.get(t, "/snippet/view/b6dL_k3fQz1x")
+	csrfToken = extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		slug         string
+		content      string
+		parentID     string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{"Valid comment", "b6dL_k3fQz1x", "Nice one", "", http.StatusSeeOther, "/snippet/view/b6dL_k3fQz1x#comment-4", ""},
+		{"Valid reply", "b6dL_k3fQz1x", "Agreed", "1", http.StatusSeeOther, "/snippet/view/b6dL_k3fQz1x#comment-4", ""},
+		{"Blank content", "b6dL_k3fQz1x", "  ", "", http.StatusUnprocessableEntity, "", "must not be blank"},
+		{"Too long", "b6dL_k3fQz1x", strings.Repeat("a", 2001), "", http.StatusUnprocessableEntity, "", "must not be more than 2000 characters"},
+		{"Missing parent", "b6dL_k3fQz1x", "Agreed", "99", http.StatusUnprocessableEntity, "", "no longer available"},
+		{"Parent on another snippet", "Mult1-F1les8", "Agreed", "1", http.StatusUnprocessableEntity, "", "no longer available"},
+		{"Burn after reading", "Burn-Aft3r-R", "Nice one", "", http.StatusNotFound, "", ""},
+		{"Missing snippet", "Miss1ng-Snip", "Nice one", "", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("content", tt.content)
+			form.Add("parent_id", tt.parentID)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, body := ts.postForm(t, "/snippet/comment/"+tt.slug, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCommentEditAndDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		id       string
+		wantCode int
+	}{
+		{"Author", "bob@email.com", "2", http.StatusSeeOther},
+		{"Snippet owner", "alice@email.com", "2", http.StatusSeeOther},
+		{"Other user", "bob@email.com", "1", http.StatusForbidden},
+		{"Missing comment", "alice@email.com", "99", http.StatusNotFound},
+		{"Invalid ID", "alice@email.com", "foo", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.login(t, tt.login)
+
+			code, _, body := ts.get(t, "/snippet/view/b6dL_k3fQz1x")
+			assert.Equal(t, code, http.StatusOK)
+			csrfToken := extractCSRFToken(t, body)
+
+			// The edit page is only shown to users who are allowed to save their changes.
+			code, _, _ = ts.get(t, "/comment/edit/"+tt.id)
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Equal(t, code, http.StatusOK)
+			} else {
+				assert.Equal(t, code, tt.wantCode)
+			}
+
+			form := url.Values{}
+			form.Add("content", "Updated")
+			form.Add("csrf_token", csrfToken)
+			code, headers, _ := ts.postForm(t, "/comment/edit/"+tt.id, form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/snippet/view/b6dL_k3fQz1x#comment-"+tt.id)
+			}
+
+			form = url.Values{}
+			form.Add("csrf_token", csrfToken)
+			code, _, _ = ts.postForm(t, "/comment/delete/"+tt.id, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestSnippetViewLines(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/snippet/view/Mult1-F1les8")
+	assert.Equal(t, code, http.StatusOK)
+
+	// The lines of the first file are numbered simply, and those of the other files are prefixed with the file's number.
+	assert.StringContains(t, body, `<tr id="L2">`)
+	assert.StringContains(t, body, `<a class="lnlinks" href="#L2">2</a>`)
+	assert.StringContains(t, body, `<tr id="F2-L1">`)
+	assert.StringContains(t, body, `<tr id="F3-L2">`)
+
+	// Bob's line comment should be shown straight after the last line it's about, rather than with the rest of the comments.
+	assert.StringContains(t, body, `on <a href="#F3-L1-L2">F3-L1-L2</a>`)
+	comment := strings.Index(body, `id="comment-5"`)
+	if comment < strings.Index(body, `<tr id="F3-L2">`) || comment > strings.Index(body, `<div class="comments">`) {
+		t.Errorf("expected the line comment to be shown after the lines it's about")
+	}
+
+	// Encrypted snippets are decrypted in the browser, so they don't have numbered lines.
+	_, _, body = ts.get(t, "/snippet/view/Encrypt3d-66")
+	if strings.Contains(body, `<tr id="L1">`) {
+		t.Errorf("expected no numbered lines for an encrypted snippet")
+	}
+}
+
+func TestSnippetCommentPostLines(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "bob@email.com")
+	_, _, body := ts.get(t, "/snippet/view/Mult1-F1les8")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name      string
+		slug      string
+		file      string
+		lineStart string
+		lineEnd   string
+		wantCode  int
+	}{
+		{"Single line", "Mult1-F1les8", "0", "2", "2", http.StatusSeeOther},
+		{"Range of lines", "Mult1-F1les8", "2", "1", "2", http.StatusSeeOther},
+		{"Missing lines", "Mult1-F1les8", "1", "1", "2", http.StatusUnprocessableEntity},
+		{"Backwards range", "Mult1-F1les8", "0", "2", "1", http.StatusUnprocessableEntity},
+		{"Missing file", "Mult1-F1les8", "3", "1", "1", http.StatusUnprocessableEntity},
+		{"Encrypted snippet", "Encrypt3d-66", "0", "1", "1", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("content", "Look at this")
+			form.Add("file", tt.file)
+			form.Add("line_start", tt.lineStart)
+			form.Add("line_end", tt.lineEnd)
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/snippet/comment/"+tt.slug, form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusUnprocessableEntity {
+				assert.StringContains(t, body, "The lines you&#39;re commenting on are no longer in the snippet")
+			}
+		})
+	}
+}
+
+func TestCollectionView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/collection/K8s-Debug1ng")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "k8s debugging")
+	assert.StringContains(t, body, "Things to try when a pod won&#39;t start.")
+	assert.StringContains(t, body, `<a href="/snippet/view/b6dL_k3fQz1x">An old silent pond</a>`)
+	assert.StringContains(t, body, `<a class="lnlinks" href="/snippet/view/Mult1-F1les8#F3-L2">2</a>`)
+	assert.StringContains(t, body, "This snippet is protected by a password.")
+	assert.StringContains(t, body, "This snippet is encrypted.")
+
+	// The snippets should be in the collection's order.
+	if strings.Index(body, "An old silent pond") > strings.Index(body, "Deployment") {
+		t.Errorf("expected the snippets to be in the collection's order")
+	}
+
+	// Alice's private snippet is only shown to her, and only she can change the collection.
+	if strings.Contains(body, "Over the wintry forest") || strings.Contains(body, "/arrange") {
+		t.Errorf("expected the private snippet and the arrange buttons to be hidden from other users")
+	}
+
+	ts.login(t, "alice@email.com")
+	_, _, body = ts.get(t, "/collection/K8s-Debug1ng")
+	assert.StringContains(t, body, "Over the wintry forest")
+	assert.StringContains(t, body, `<a href="/collection/K8s-Debug1ng/edit">Edit collection</a>`)
+	assert.StringContains(t, body, `<button name="action" value="down">&darr; Move down</button>`)
+
+	tests := []struct {
+		name     string
+		login    string
+		urlPath  string
+		wantCode int
+	}{
+		{"Private collection", "", "/collection/Pr1vate-C0ll", http.StatusNotFound},
+		{"Other user's private collection", "bob@email.com", "/collection/Pr1vate-C0ll", http.StatusNotFound},
+		{"Own private collection", "alice@email.com", "/collection/Pr1vate-C0ll", http.StatusOK},
+		{"Unlisted collection", "", "/collection/B0bs-Favour1", http.StatusOK},
+		{"Missing collection", "", "/collection/Miss1ng-C0ll", http.StatusNotFound},
+		{"Invalid slug", "", "/collection/foo", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.login != "" {
+				ts.login(t, tt.login)
+			}
+
+			code, _, _ := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestCollectionCreatePost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, _ := ts.get(t, "/account/collections/create")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	ts.login(t, "alice@email.com")
+	_, _, body := ts.get(t, "/account/collections/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		title        string
+		visibility   string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{"Valid collection", "k8s debugging", "unlisted", http.StatusSeeOther, "/collection/N3wC0llect-4", ""},
+		{"Blank title", "", "public", http.StatusUnprocessableEntity, "", "must not be blank"},
+		{"Long title", strings.Repeat("a", 101), "public", http.StatusUnprocessableEntity, "", "must not be more than 100 characters"},
+		{"Invalid visibility", "k8s debugging", "secret", http.StatusUnprocessableEntity, "", "must be public, unlisted or private"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("description", "Things to try")
+			form.Add("visibility", tt.visibility)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, body := ts.postForm(t, "/account/collections/create", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCollectionEditAndDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		slug     string
+		wantCode int
+	}{
+		{"Owner", "alice@email.com", "K8s-Debug1ng", http.StatusSeeOther},
+		{"Other user", "bob@email.com", "K8s-Debug1ng", http.StatusForbidden},
+		{"Other user's private collection", "bob@email.com", "Pr1vate-C0ll", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.login(t, tt.login)
+			_, _, body := ts.get(t, "/account/collections")
+			csrfToken := extractCSRFToken(t, body)
+
+			form := url.Values{}
+			form.Add("title", "Renamed")
+			form.Add("visibility", "public")
+			form.Add("csrf_token", csrfToken)
+			code, _, _ := ts.postForm(t, "/collection/"+tt.slug+"/edit", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			form = url.Values{}
+			form.Add("csrf_token", csrfToken)
+			code, headers, _ := ts.postForm(t, "/collection/"+tt.slug+"/delete", form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/account/collections")
+			}
+		})
+	}
+}
+
+func TestCollectionArrangePost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@email.com")
+	_, _, body := ts.get(t, "/collection/K8s-Debug1ng")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		snippet  string
+		action   string
+		wantCode int
+	}{
+		{"Move up", "Mult1-F1les8", "up", http.StatusSeeOther},
+		{"Move down", "Mult1-F1les8", "down", http.StatusSeeOther},
+		{"Remove", "Encrypt3d-66", "remove", http.StatusSeeOther},
+		{"Snippet not in collection", "Burn-Aft3r-R", "up", http.StatusBadRequest},
+		{"Missing snippet", "Miss1ng-Snip", "up", http.StatusBadRequest},
+		{"Invalid action", "Mult1-F1les8", "sideways", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("snippet", tt.snippet)
+			form.Add("action", tt.action)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postForm(t, "/collection/K8s-Debug1ng/arrange", form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/collection/K8s-Debug1ng")
+			}
+		})
+	}
+}
+
+func TestSnippetCollectPost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@email.com")
+
+	// mockSnippet is in both of Alice's collections, so she can only remove it.
+	_, _, body := ts.get(t, "/snippet/view/b6dL_k3fQz1x")
+	assert.StringContains(t, body, `In <a href="/collection/K8s-Debug1ng">k8s debugging</a>`)
+	assert.StringContains(t, body, `In <a href="/collection/Pr1vate-C0ll">Drafts</a>`)
+	if strings.Contains(body, "Add to collection") {
+		t.Errorf("expected no add button when the snippet is in all of the user's collections")
+	}
+
+	_, _, body = ts.get(t, "/snippet/view/Mult1-F1les8")
+	assert.StringContains(t, body, `<option value="Pr1vate-C0ll">Drafts</option>`)
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		slug       string
+		collection string
+		action     string
+		wantCode   int
+	}{
+		{"Add", "Mult1-F1les8", "Pr1vate-C0ll", "add", http.StatusSeeOther},
+		{"Remove", "Mult1-F1les8", "K8s-Debug1ng", "remove", http.StatusSeeOther},
+		{"Other user's collection", "Mult1-F1les8", "B0bs-Favour1", "add", http.StatusBadRequest},
+		{"Missing collection", "Mult1-F1les8", "Miss1ng-C0ll", "add", http.StatusBadRequest},
+		{"Invalid action", "Mult1-F1les8", "K8s-Debug1ng", "keep", http.StatusBadRequest},
+		{"Burn after reading", "Burn-Aft3r-R", "K8s-Debug1ng", "add", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("collection", tt.collection)
+			form.Add("action", tt.action)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postForm(t, "/snippet/collect/"+tt.slug, form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/snippet/view/"+tt.slug)
+			}
+		})
+	}
+}
+
+func TestOrgSnippetView(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		slug     string
+		wantCode int
+		wantEdit bool
+	}{
+		{"Anonymous", "", "0rg-Sn1ppet1", http.StatusNotFound, false},
+		{"Creator", "alice@email.com", "0rg-Sn1ppet1", http.StatusOK, true},
+		{"Other member", "bob@email.com", "0rg-Sn1ppet1", http.StatusOK, true},
+		{"Not a member", "alice@email.com", "B0bc0-Sn1p12", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.login != "" {
+				ts.login(t, tt.login)
+			}
+
+			code, _, body := ts.get(t, "/snippet/view/"+tt.slug)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, `href="/snippet/edit/`+tt.slug+`"`), tt.wantEdit)
+			if code == http.StatusOK {
+				assert.StringContains(t, body, `owned by <a href="/org/acme">Acme Corp</a>`)
+			}
+
+			code, _, _ = ts.get(t, "/snippet/raw/"+tt.slug)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestSnippetCreatePostOrg(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@email.com")
+
+	_, _, body := ts.get(t, "/snippet/create?org=acme")
+	assert.StringContains(t, body, `<option value="acme" selected>Acme Corp</option>`)
+	assert.StringContains(t, body, `<option value="org" >Members only`)
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		org        string
+		visibility string
+		wantCode   int
+	}{
+		{"Members only", "acme", "org", http.StatusSeeOther},
+		{"Public", "acme", "public", http.StatusSeeOther},
+		{"Private", "acme", "private", http.StatusUnprocessableEntity},
+		{"Not a member", "bobco", "org", http.StatusUnprocessableEntity},
+		{"Missing org", "nope", "public", http.StatusUnprocessableEntity},
+		{"Members only without an org", "", "org", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Team notes")
+			form.Add("content", "Deploy on Tuesdays")
+			form.Add("expires", "7d")
+			form.Add("visibility", tt.visibility)
+			form.Add("org", tt.org)
+			form.Add("csrf_token", csrfToken)
+
+			code, _, _ := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestOrgView(t *testing.T) {
+	tests := []struct {
+		name          string
+		login         string
+		urlPath       string
+		wantCode      int
+		wantPrivate   bool // whether the members-only snippet and the members are shown
+		wantAddMember bool
+	}{
+		{"Anonymous", "", "/org/acme", http.StatusOK, false, false},
+		{"Member", "bob@email.com", "/org/acme", http.StatusOK, true, false},
+		{"Owner", "alice@email.com", "/org/acme", http.StatusOK, true, true},
+		{"Missing org", "", "/org/nope", http.StatusNotFound, false, false},
+		{"Invalid slug", "", "/org/A", http.StatusNotFound, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.login != "" {
+				ts.login(t, tt.login)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if code != http.StatusOK {
+				return
+			}
+
+			assert.StringContains(t, body, `<a href="/snippet/view/Mult1-F1les8">Deployment</a>`)
+			assert.Equal(t, strings.Contains(body, "Team runbook"), tt.wantPrivate)
+			assert.Equal(t, strings.Contains(body, "<h3>Members</h3>"), tt.wantPrivate)
+			assert.Equal(t, strings.Contains(body, `action="/org/acme/members"`), tt.wantAddMember)
+		})
+	}
+}
+
+func TestOrgCreatePost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@email.com")
+	_, _, body := ts.get(t, "/account/orgs/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		slug     string
+		orgName  string
+		wantCode int
+	}{
+		{"Valid", "initech", "Initech", http.StatusSeeOther},
+		{"Duplicate slug", "acme", "Acme Again", http.StatusUnprocessableEntity},
+		{"Invalid slug", "Initech!", "Initech", http.StatusUnprocessableEntity},
+		{"Blank name", "initech", "", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("slug", tt.slug)
+			form.Add("name", tt.orgName)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postForm(t, "/account/orgs/create", form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/org/"+tt.slug)
+			}
+		})
+	}
+}
+
+func TestOrgMemberPost(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		org      string
+		username string
+		role     string
+		wantCode int
+	}{
+		{"Owner adds an owner", "alice@email.com", "acme", "bob", "owner", http.StatusSeeOther},
+		{"Unknown user", "alice@email.com", "acme", "carol", "member", http.StatusUnprocessableEntity},
+		{"Invalid role", "alice@email.com", "acme", "bob", "admin", http.StatusUnprocessableEntity},
+		{"Demoting the last owner", "alice@email.com", "acme", "alice", "member", http.StatusUnprocessableEntity},
+		{"Member", "bob@email.com", "acme", "bob", "owner", http.StatusForbidden},
+		{"Not a member", "alice@email.com", "bobco", "alice", "member", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.login(t, tt.login)
+			_, _, body := ts.get(t, "/account/orgs")
+			csrfToken := extractCSRFToken(t, body)
+
+			form := url.Values{}
+			form.Add("username", tt.username)
+			form.Add("role", tt.role)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postForm(t, "/org/"+tt.org+"/members", form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/org/"+tt.org)
+			}
+		})
+	}
+}
+
+func TestOrgMemberRemovePost(t *testing.T) {
+	tests := []struct {
+		name         string
+		login        string
+		org          string
+		userID       string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Owner removes a member", "alice@email.com", "acme", "2", http.StatusSeeOther, "/org/acme"},
+		{"Member leaves", "bob@email.com", "acme", "2", http.StatusSeeOther, "/account/orgs"},
+		{"Member removes an owner", "bob@email.com", "acme", "1", http.StatusForbidden, ""},
+		{"Last owner leaves", "alice@email.com", "acme", "1", http.StatusUnprocessableEntity, ""},
+		{"Not a member of the org", "alice@email.com", "acme", "3", http.StatusBadRequest, ""},
+		{"Other org", "alice@email.com", "bobco", "2", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.login(t, tt.login)
+			_, _, body := ts.get(t, "/account/orgs")
+			csrfToken := extractCSRFToken(t, body)
+
+			form := url.Values{}
+			form.Add("user_id", tt.userID)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postForm(t, "/org/"+tt.org+"/members/remove", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestUserSignupRegistration(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		invite       string
+		username     string
+		email        string
+		wantGetCode  int
+		wantPostCode int
+		wantBody     string
+	}{
+		{"Open", registrationOpen, "", "carol", "carol@other.com", http.StatusOK, http.StatusSeeOther, ""},
+		{"Closed", registrationClosed, "", "carol", "carol@other.com", http.StatusForbidden, http.StatusForbidden, "Registration is closed"},
+		{"Closed with an invite", registrationClosed, "0pen-Inv1te-Code-12345", "carol", "carol@other.com", http.StatusForbidden, http.StatusForbidden, "Registration is closed"},
+		{"Invite only without an invite", registrationInvite, "", "carol", "carol@other.com", http.StatusForbidden, http.StatusForbidden, "by invitation only"},
+		{"Invite only with an invite", registrationInvite, "0pen-Inv1te-Code-12345", "carol", "carol@other.com", http.StatusOK, http.StatusSeeOther, `<input type="hidden" name="invite" value="0pen-Inv1te-Code-12345">`},
+		{"Used invite", registrationInvite, "Used-Inv1te-Code-12345", "carol", "carol@other.com", http.StatusForbidden, http.StatusForbidden, "already been used"},
+		{"Invalid invite", registrationInvite, "nope", "carol", "carol@other.com", http.StatusForbidden, http.StatusForbidden, "already been used"},
+		{"Invite for the email address", registrationInvite, "Ema1l-Inv1te-Code-1234", "carol", "carol@example.com", http.StatusOK, http.StatusSeeOther, `value="carol@example.com" readonly`},
+		{"Invite for another email address", registrationInvite, "Ema1l-Inv1te-Code-1234", "carol", "dave@example.com", http.StatusOK, http.StatusUnprocessableEntity, "the email address you were invited with"},
+		{"Invite with a duplicate username", registrationInvite, "0pen-Inv1te-Code-12345", "alice", "carol@other.com", http.StatusOK, http.StatusUnprocessableEntity, "Username is already taken"},
+		{"Allowed domain", registrationDomains, "", "carol", "carol@example.com", http.StatusOK, http.StatusSeeOther, ""},
+		{"Other domain", registrationDomains, "", "carol", "carol@other.com", http.StatusOK, http.StatusUnprocessableEntity, "must be an email address at example.com"},
+		{"Other domain with an invite", registrationDomains, "0pen-Inv1te-Code-12345", "carol", "carol@other.com", http.StatusOK, http.StatusSeeOther, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.registration = registrationPolicy{mode: tt.mode, domains: []string{"example.com"}}
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			urlPath := "/user/signup"
+			if tt.invite != "" {
+				urlPath += "?invite=" + tt.invite
+			}
+			code, _, body := ts.get(t, urlPath)
+			assert.Equal(t, code, tt.wantGetCode)
+
+			// The signup form isn't shown if the user can't sign up, so take the CSRF token from the login form instead.
+			_, _, loginBody := ts.get(t, "/user/login")
+
+			form := url.Values{}
+			form.Add("name", "Carol")
+			form.Add("username", tt.username)
+			form.Add("email", tt.email)
+			form.Add("password", "validPa$$word")
+			form.Add("invite", tt.invite)
+			form.Add("csrf_token", extractCSRFToken(t, loginBody))
+
+			code, _, postBody := ts.postForm(t, "/user/signup", form)
+			assert.Equal(t, code, tt.wantPostCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body+postBody, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAccountInvites(t *testing.T) {
+	tests := []struct {
+		name        string
+		login       string
+		mode        string
+		userInvites bool
+		wantCode    int
+		wantBody    string
+	}{
+		{"Admin", "bob@email.com", registrationInvite, false, http.StatusOK, `<a href="/user/signup?invite=0pen-Inv1te-Code-12345">Signup link</a>`},
+		{"User", "alice@email.com", registrationInvite, false, http.StatusForbidden, ""},
+		{"User with user invites", "alice@email.com", registrationInvite, true, http.StatusOK, "carol@example.com"},
+		{"Closed", "bob@email.com", registrationClosed, true, http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.registration = registrationPolicy{mode: tt.mode, userInvites: tt.userInvites}
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.login(t, tt.login)
+
+			_, _, body := ts.get(t, "/account")
+			assert.Equal(t, strings.Contains(body, `<a href="/account/invites">invite people</a>`), tt.wantCode == http.StatusOK)
+
+			code, _, body := ts.get(t, "/account/invites")
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAccountInvitePosts(t *testing.T) {
+	app := newTestApplication(t)
+	app.registration = registrationPolicy{mode: registrationInvite}
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "bob@email.com")
+	_, _, body := ts.get(t, "/account/invites")
+	assert.StringContains(t, body, "Used by dave@example.com")
+	csrfToken := extractCSRFToken(t, body)
+
 	tests := []struct {
 		name     string
 		urlPath  string
+		field    string
+		value    string
+		wantCode int
+	}{
+		{"Create", "/account/invites/create", "email", "", http.StatusSeeOther},
+		{"Create for an email address", "/account/invites/create", "email", "carol@example.com", http.StatusSeeOther},
+		{"Create for an invalid email address", "/account/invites/create", "email", "carol", http.StatusUnprocessableEntity},
+		{"Delete", "/account/invites/delete", "id", "1", http.StatusSeeOther},
+		{"Delete a used invite", "/account/invites/delete", "id", "3", http.StatusBadRequest},
+		{"Delete another user's invite", "/account/invites/delete", "id", "2", http.StatusBadRequest},
+		{"Delete with an invalid ID", "/account/invites/delete", "id", "x", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add(tt.field, tt.value)
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/account/invites")
+			}
+		})
+	}
+}
+
+func TestUserLoginOIDC(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		claims   map[string]any
 		wantCode int
 		wantBody string
-	}{{name: "Valid ID", urlPath: "/snippet/view/1", wantCode: http.StatusOK, wantBody: "An old silent pond..."}, {name: "Non-existent ID", urlPath: "/snippet/view/2", wantCode: http.StatusNotFound}, {name: "Negative ID", urlPath: "/snippet/view/-1", wantCode: http.StatusNotFound},
-		{name: "Decimal ID", urlPath: "/snippet/view/1.23", wantCode: http.StatusNotFound}, {name: "String ID", urlPath: "/snippet/view/foo", wantCode: http.StatusNotFound}, {name: "Empty ID", urlPath: "/snippet/view/", wantCode: http.StatusNotFound}}
+	}{
+		{"Linked account", registrationOpen, map[string]any{"sub": "alice-sub", "email": "alice@elsewhere.com"}, http.StatusSeeOther, `<a href="/u/alice">`},
+		{"Verified email of an existing user", registrationOpen, map[string]any{"sub": "bob-sub", "email": "bob@email.com", "email_verified": true}, http.StatusSeeOther, `<a href="/u/bob">`},
+		{"Unverified email of an existing user", registrationOpen, map[string]any{"sub": "bob-sub", "email": "bob@email.com"}, http.StatusUnauthorized, "hasn&#39;t been verified"},
+		{"New user", registrationOpen, map[string]any{"sub": "carol-sub", "email": "carol@example.com", "email_verified": true, "name": "Carol"}, http.StatusSeeOther, ""},
+		{"New user with a taken username", registrationOpen, map[string]any{"sub": "carol-sub", "email": "carol@example.com", "email_verified": true, "preferred_username": "alice"}, http.StatusSeeOther, ""},
+		{"New user when registration is closed", registrationClosed, map[string]any{"sub": "carol-sub", "email": "carol@example.com", "email_verified": true}, http.StatusForbidden, "Registration is closed"},
+		{"New user when registration is by invitation", registrationInvite, map[string]any{"sub": "carol-sub", "email": "carol@example.com", "email_verified": true}, http.StatusForbidden, "by invitation only"},
+		{"New user at an allowed domain", registrationDomains, map[string]any{"sub": "carol-sub", "email": "carol@example.com", "email_verified": true}, http.StatusSeeOther, ""},
+		{"New user at another domain", registrationDomains, map[string]any{"sub": "carol-sub", "email": "carol@other.com", "email_verified": true}, http.StatusForbidden, "Only email addresses at example.com"},
+		{"Existing user when registration is closed", registrationClosed, map[string]any{"sub": "bob-sub", "email": "bob@email.com", "email_verified": true}, http.StatusSeeOther, `<a href="/u/bob">`},
+	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			code, _, body := ts.get(t, tt.urlPath)
+			stub := newStubOIDCProvider(t)
+			defer stub.Close()
+			stub.claims = tt.claims
+
+			app := newTestApplication(t)
+			app.registration = registrationPolicy{mode: tt.mode, domains: []string{"example.com"}}
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+			app.oidc = stub.provider(t, ts.URL+"/user/login/oidc/callback")
+
+			_, _, body := ts.get(t, "/user/login")
+			assert.StringContains(t, body, `<a href="/user/login/oidc">Log in with Stub</a>`)
+
+			code, headers, _ := ts.get(t, "/user/login/oidc")
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			code, headers, body = ts.get(t, stub.authorize(t, headers.Get("Location")))
 			assert.Equal(t, code, tt.wantCode)
 
+			if code != http.StatusSeeOther {
+				assert.StringContains(t, body, tt.wantBody)
+				return
+			}
+			assert.Equal(t, headers.Get("Location"), "/snippet/create")
+
+			// Users who already existed can see their account page, since they're now logged in.
 			if tt.wantBody != "" {
+				code, _, body = ts.get(t, "/account")
+				assert.Equal(t, code, http.StatusOK)
 				assert.StringContains(t, body, tt.wantBody)
 			}
 		})
 	}
 }
+
+func TestUserLoginOIDCCallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(stub *stubOIDCProvider, callback string) string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid",
+			tamper:   func(stub *stubOIDCProvider, callback string) string { return callback },
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name: "Wrong state",
+			tamper: func(stub *stubOIDCProvider, callback string) string {
+				return "/user/login/oidc/callback?code=stub-code&state=wrong"
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "Cancelled",
+			tamper: func(stub *stubOIDCProvider, callback string) string {
+				return strings.Replace(callback, "code=stub-code", "error=access_denied", 1)
+			},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Logging in with Stub was cancelled",
+		},
+		{
+			name: "Wrong PKCE verifier",
+			tamper: func(stub *stubOIDCProvider, callback string) string {
+				stub.challenge = "wrong"
+				return callback
+			},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Logging in with Stub failed",
+		},
+		{
+			name: "Wrong nonce",
+			tamper: func(stub *stubOIDCProvider, callback string) string {
+				stub.nonce = "wrong"
+				return callback
+			},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Logging in with Stub failed",
+		},
+		{
+			name: "Token for another client",
+			tamper: func(stub *stubOIDCProvider, callback string) string {
+				stub.claims["aud"] = "someone-else"
+				return callback
+			},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Logging in with Stub failed",
+		},
+		{
+			name: "Expired token",
+			tamper: func(stub *stubOIDCProvider, callback string) string {
+				stub.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				return callback
+			},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Logging in with Stub failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newStubOIDCProvider(t)
+			defer stub.Close()
+			stub.claims = map[string]any{"sub": "alice-sub"}
+
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+			app.oidc = stub.provider(t, ts.URL+"/user/login/oidc/callback")
+
+			_, headers, _ := ts.get(t, "/user/login/oidc")
+			callback := tt.tamper(stub, stub.authorize(t, headers.Get("Location")))
+
+			code, _, body := ts.get(t, callback)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+
+			// Each login can only be completed once.
+			code, _, _ = ts.get(t, callback)
+			assert.Equal(t, code, http.StatusBadRequest)
+		})
+	}
+
+	t.Run("Not set up", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		_, _, body := ts.get(t, "/user/login")
+		assert.Equal(t, strings.Contains(body, "/user/login/oidc"), false)
+
+		code, _, _ := ts.get(t, "/user/login/oidc")
+		assert.Equal(t, code, http.StatusNotFound)
+
+		code, _, _ = ts.get(t, "/user/login/oidc/callback?code=stub-code&state=state")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
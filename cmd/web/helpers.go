@@ -3,12 +3,21 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"regexp"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
+	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/nosurf"
+	"snippetbox.linze.me/internal/diff"
+	"snippetbox.linze.me/internal/highlight"
+	"snippetbox.linze.me/internal/models"
+	"snippetbox.linze.me/internal/validator"
 )
 
 // The serverError helper writes an error message and stack trace to the errorLog,
@@ -39,12 +48,22 @@ func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
 		CurrentYear: time.Now().Year(),
 		// Add the flash message to the template data, if one exists.
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r),
+		Flash:             app.sessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated:   app.isAuthenticated(r),
+		AuthenticatedUser: app.authenticatedUser(r),
+		CSRFToken:         nosurf.Token(r),
+		OIDCName:          app.oidcName(),
 	}
 }
 
+// The oidcName() helper returns the name of the single sign-on provider, or "" if single sign-on isn't set up.
+func (app *application) oidcName() string {
+	if app.oidc == nil {
+		return ""
+	}
+	return app.oidc.name
+}
+
 // Create a new decodePostForm() helper method. The second parameter here, dst,is the target destination that we want to decode the form data into.
 func (app *application) decodePostForm(r *http.Request, dst any) error {
 	// Call ParseForm() on the request, in the same way that we did in our createSnippetPost handler.
@@ -80,3 +99,1154 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	}
 	return isAuthenticated
 }
+
+// Return the user who made the current request, or nil if the request isn't from an authenticated user.
+func (app *application) authenticatedUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(authenticatedUserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// The orgRole() helper returns the role of the user making the request in an organization, or an empty string if they aren't a member of it.
+// The roles are loaded by the authenticate middleware, so this doesn't need a database query.
+func (app *application) orgRole(r *http.Request, orgID int) string {
+	if orgID == 0 {
+		return ""
+	}
+
+	roles, ok := r.Context().Value(orgRolesContextKey).(map[int]string)
+	if !ok {
+		return ""
+	}
+	return roles[orgID]
+}
+
+// The isOwner() helper returns true if the user making the request owns the snippet.
+// A personal snippet is owned by the user who created it, but a snippet which belongs to an organization is owned by all of the organization's
+// members, and no longer by its creator if they leave the organization.
+func (app *application) isOwner(r *http.Request, snippet *models.Snippet) bool {
+	if snippet.OrgID != 0 {
+		return app.orgRole(r, snippet.OrgID) != ""
+	}
+
+	user := app.authenticatedUser(r)
+	return user != nil && user.ID == snippet.UserID
+}
+
+// The canView() helper returns true if the user making the request is allowed to view the snippet.
+// Public and unlisted snippets can be viewed by anyone, but private and members-only snippets can only be viewed by their owners.
+func (app *application) canView(r *http.Request, snippet *models.Snippet) bool {
+	if snippet.Visibility != models.VisibilityPrivate && snippet.Visibility != models.VisibilityOrg {
+		return true
+	}
+
+	return app.isOwner(r, snippet)
+}
+
+// The isListed() helper returns true if the snippet can be listed on pages other than its own, for the user making the request.
+// That's the case for public snippets, and for any snippet the user owns. Listing an unlisted snippet would reveal its URL, so they're only shown to their owners.
+func (app *application) isListed(r *http.Request, snippet *models.Snippet) bool {
+	if snippet.Visibility == models.VisibilityPublic {
+		return true
+	}
+
+	return app.isOwner(r, snippet)
+}
+
+// The isUnlocked() helper returns true if the user making the request can see the content of the snippet without entering a password.
+// That's the case if the snippet doesn't have a password, if the user is one of its owners, or if they've already entered the password during their current session.
+func (app *application) isUnlocked(r *http.Request, snippet *models.Snippet) bool {
+	if !snippet.HasPassword() {
+		return true
+	}
+
+	if app.isOwner(r, snippet) {
+		return true
+	}
+
+	unlocked, _ := app.sessionManager.Get(r.Context(), "unlockedSnippets").([]string)
+	return validator.PermittedValue(snippet.Slug, unlocked...)
+}
+
+// The canEdit() helper returns true if the user making the request is allowed to edit the snippet.
+// Only its owners can edit a snippet. Snippets which are burned after reading or encrypted can't be edited at all, because
+// showing their content in the edit form would bypass the reveal page, and the server can't decrypt them.
+func (app *application) canEdit(r *http.Request, snippet *models.Snippet) bool {
+	return app.isOwner(r, snippet) && !snippet.BurnAfterReading && !snippet.Encrypted
+}
+
+// The canFork() helper returns true if the user making the request can fork the snippet: that is, if they can see its content.
+// Snippets which are burned after reading or encrypted can't be forked, because the server would have to reveal or decrypt their content.
+func (app *application) canFork(r *http.Request, snippet *models.Snippet) bool {
+	return app.canView(r, snippet) && app.isUnlocked(r, snippet) && !snippet.BurnAfterReading && !snippet.Encrypted
+}
+
+// The canComment() helper returns true if the user making the request can comment on the snippet.
+// Comments are only for logged-in users who can see the snippet's content, and not for snippets which are burned after reading.
+func (app *application) canComment(r *http.Request, snippet *models.Snippet) bool {
+	return app.isAuthenticated(r) && app.canView(r, snippet) && app.isUnlocked(r, snippet) && !snippet.BurnAfterReading
+}
+
+// The canModifyComment() helper returns true if the user making the request can edit or delete a comment on the snippet.
+// That's the comment's author, or the owners of the snippet (who can tidy up the comments on their own snippets).
+func (app *application) canModifyComment(r *http.Request, snippet *models.Snippet, comment *models.Comment) bool {
+	user := app.authenticatedUser(r)
+	if user == nil || comment.Deleted {
+		return false
+	}
+	return user.ID == comment.UserID || app.isOwner(r, snippet)
+}
+
+// The commentFromParams() helper fetches the comment whose ID is in the "id" route parameter, along with the snippet it belongs to,
+// for the handlers which edit or delete comments. If the comment doesn't exist, or the user can't see it, it sends a 404 Not Found response.
+// If the user can see the comment but isn't allowed to modify it, it sends a 403 Forbidden response. In either case, it returns false.
+func (app *application) commentFromParams(w http.ResponseWriter, r *http.Request) (*models.Comment, *models.Snippet, bool) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil, nil, false
+	}
+
+	comment, err := app.comments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, nil, false
+	}
+
+	snippet, err := app.snippets.Get(comment.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, nil, false
+	}
+
+	if !app.canComment(r, snippet) {
+		app.notFound(w)
+		return nil, nil, false
+	}
+
+	if !app.canModifyComment(r, snippet, comment) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	return comment, snippet, true
+}
+
+// The commentURL() helper returns the URL of a comment on the snippet page.
+// Encrypted snippets keep their key in the URL fragment, so for them we can't link straight to the comment.
+func commentURL(snippet *models.Snippet, commentID int) string {
+	url := "/snippet/view/" + snippet.Slug
+	if !snippet.Encrypted {
+		url += fmt.Sprintf("#comment-%d", commentID)
+	}
+	return url
+}
+
+// The snippetLines() helper highlights each of a snippet's files line by line for the snippet page, and works out which comments are
+// shown next to the lines they're about. It returns the lines of each file (by position), and the rest of the comments, which are about
+// the snippet as a whole. Replies are shown along with the comment at the start of their thread. Line comments about lines which are no
+// longer in the snippet (because it's been edited) are shown with the rest of the comments. Encrypted snippets are decrypted in the browser,
+// so they don't have any lines.
+func snippetLines(snippet *models.Snippet, comments []*models.Comment) ([][]*codeLine, []*models.Comment, error) {
+	if snippet.Encrypted {
+		return nil, comments, nil
+	}
+
+	lines := make([][]*codeLine, len(snippet.Files))
+	for i, file := range snippet.Files {
+		highlighted, err := highlight.Lines(file.Name, file.Language, file.Content)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, line := range highlighted {
+			lines[i] = append(lines[i], &codeLine{Line: line, Anchor: models.LineAnchor(i, line.Number)})
+		}
+	}
+
+	// The comments are in thread order, so each thread starts with a comment with a depth of 0.
+	general := []*models.Comment{}
+	var thread *codeLine
+	for _, c := range comments {
+		if c.Depth == 0 {
+			thread = nil
+			if c.IsLineComment() && validLineRange(snippet, c.File, c.LineStart, c.LineEnd) {
+				thread = lines[c.File][c.LineEnd-1]
+			}
+		}
+
+		if thread != nil {
+			thread.Comments = append(thread.Comments, c)
+		} else {
+			general = append(general, c)
+		}
+	}
+
+	return lines, general, nil
+}
+
+// The validLineRange() helper returns true if the file at the given position in the snippet has the lines from start to end.
+func validLineRange(snippet *models.Snippet, file, start, end int) bool {
+	return file >= 0 && file < len(snippet.Files) && start >= 1 && start <= end && end <= snippet.Files[file].LineCount()
+}
+
+// The collectionFromParams() helper fetches the collection identified by the "slug" parameter in the URL, so long as the current user is allowed to view it.
+// Like snippets, private collections can only be viewed by their owner. If the collection doesn't exist or can't be viewed it sends a 404 Not Found
+// response and returns false.
+func (app *application) collectionFromParams(w http.ResponseWriter, r *http.Request) (*models.Collection, bool) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	if !validator.Matches(slug, models.SlugRX) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	collection, err := app.collections.GetBySlug(slug)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	if collection.Visibility == models.VisibilityPrivate && !app.ownsCollection(r, collection) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return collection, true
+}
+
+// The ownCollectionFromParams() helper is like collectionFromParams(), for the handlers which change a collection.
+// If the user can see the collection but doesn't own it, it sends a 403 Forbidden response and returns false.
+func (app *application) ownCollectionFromParams(w http.ResponseWriter, r *http.Request) (*models.Collection, bool) {
+	collection, ok := app.collectionFromParams(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if !app.ownsCollection(r, collection) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return collection, true
+}
+
+// The ownsCollection() helper returns true if the user making the request owns the collection.
+func (app *application) ownsCollection(r *http.Request, collection *models.Collection) bool {
+	user := app.authenticatedUser(r)
+	return user != nil && user.ID == collection.UserID
+}
+
+// The canCollect() helper returns true if the user making the request can add the snippet to their collections.
+// Snippets which are burned after reading can't be added, since there'd be nothing left to see by the time anyone followed the link.
+func (app *application) canCollect(r *http.Request, snippet *models.Snippet) bool {
+	return app.isAuthenticated(r) && app.canView(r, snippet) && !snippet.BurnAfterReading
+}
+
+// The collectionItems() helper prepares the snippets in a collection to be shown on the collection page. Snippets which the user can't view
+// are left out. The content of the rest is highlighted, except for snippets which are encrypted, or protected by a password which the user
+// hasn't entered yet: they're shown as links to the snippet's own page, which is the only place their content can be seen.
+func (app *application) collectionItems(r *http.Request, snippets []*models.Snippet) ([]*collectionItem, error) {
+	items := []*collectionItem{}
+
+	for _, snippet := range snippets {
+		if !app.canView(r, snippet) {
+			continue
+		}
+
+		item := &collectionItem{Snippet: snippet}
+		if snippet.Encrypted || snippet.BurnAfterReading || !app.isUnlocked(r, snippet) {
+			item.Locked = true
+		} else {
+			lines, _, err := snippetLines(snippet, nil)
+			if err != nil {
+				return nil, err
+			}
+			item.Lines = lines
+		}
+
+		items = append(items, item)
+	}
+
+	if len(items) > 0 {
+		items[0].First = true
+		items[len(items)-1].Last = true
+	}
+
+	return items, nil
+}
+
+// The orgFromParams() helper fetches the organization identified by the "slug" parameter in the URL.
+// If there's no such organization, it sends a 404 Not Found response and returns false.
+func (app *application) orgFromParams(w http.ResponseWriter, r *http.Request) (*models.Org, bool) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	if !validator.Matches(slug, models.OrgSlugRX) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	org, err := app.orgs.GetBySlug(slug)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	return org, true
+}
+
+// The renderOrg() helper shows a page of an organization's snippets, along with its members if the user is one of them.
+// The form is for adding members, which is only shown to owners.
+func (app *application) renderOrg(w http.ResponseWriter, r *http.Request, status int, org *models.Org, page int, form orgMemberForm) {
+	role := app.orgRole(r, org.ID)
+
+	snippets, total, err := app.snippets.ByOrg(org.ID, role != "", pageSize, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if page > 1 && len(snippets) == 0 {
+		app.notFound(w)
+		return
+	}
+
+	var members []*models.Member
+	if role != "" {
+		members, err = app.orgs.Members(org.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Org = org
+	data.OrgRole = role
+	data.Members = members
+	data.Snippets = snippets
+	data.Pagination = newPagination("/org/"+org.Slug, page, pageSize, total)
+	data.Form = form
+	app.render(w, status, "org.tmpl", data)
+}
+
+// The isLastOwner() helper returns true if the user is the only owner of an organization, given its members.
+func isLastOwner(members []*models.Member, userID int) bool {
+	owners := 0
+	owner := false
+	for _, m := range members {
+		if m.Role == models.OrgRoleOwner {
+			owners++
+			owner = owner || m.UserID == userID
+		}
+	}
+	return owner && owners == 1
+}
+
+// The signupInvite() helper checks that the registration mode lets someone sign up, given the invite code from their signup link or form, which may be empty.
+// It returns the invite if the code is valid, or nil if there isn't a code. If they aren't allowed to sign up (or the code isn't valid), it shows them why
+// with a 403 Forbidden response and returns false.
+func (app *application) signupInvite(w http.ResponseWriter, r *http.Request, code string) (*models.Invite, bool) {
+	if app.registration.mode == registrationClosed {
+		app.renderSignupClosed(w, r, "Registration is closed. Ask an administrator if you need an account.")
+		return nil, false
+	}
+
+	var invite *models.Invite
+	if code != "" {
+		// There's no need to hit the database for a code which can't be valid.
+		err := models.ErrNoRecord
+		if validator.Matches(code, models.InviteCodeRX) {
+			invite, err = app.invites.GetByCode(code)
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.renderSignupClosed(w, r, "This invite has already been used, or has expired.")
+			} else {
+				app.serverError(w, err)
+			}
+			return nil, false
+		}
+	}
+
+	if invite == nil && app.registration.mode == registrationInvite {
+		app.renderSignupClosed(w, r, "Registration is by invitation only. Ask an existing user to invite you.")
+		return nil, false
+	}
+
+	return invite, true
+}
+
+// The renderSignupClosed() helper shows the signup page without the form, explaining why the user can't sign up.
+func (app *application) renderSignupClosed(w http.ResponseWriter, r *http.Request, notice string) {
+	data := app.newTemplateData(r)
+	data.RegistrationNotice = notice
+	app.render(w, http.StatusForbidden, "signup.tmpl", data)
+}
+
+// The emailDomainAllowed() helper returns true if the email address is at one of the domains, which should be in lowercase.
+// Subdomains have to be listed separately.
+func emailDomainAllowed(email string, domains []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return false
+	}
+	return validator.PermittedValue(strings.ToLower(email[at+1:]), domains...)
+}
+
+// The canInvite() helper returns true if the user making the request can create invites. Admins always can, and other users can if
+// the -user-invites flag is set -- unless registration is closed, in which case invites can't be used anyway.
+func (app *application) canInvite(r *http.Request) bool {
+	if app.registration.mode == registrationClosed {
+		return false
+	}
+
+	user := app.authenticatedUser(r)
+	return user.HasRole(models.RoleAdmin) || (user != nil && app.registration.userInvites)
+}
+
+// inviteLifetime is how long an invite can be used for after it's created.
+const inviteLifetime = 7 * 24 * time.Hour
+
+// The renderInvites() helper shows the invites the user has created, along with the form for creating another one.
+func (app *application) renderInvites(w http.ResponseWriter, r *http.Request, status int, form inviteForm) {
+	invites, err := app.invites.ByCreator(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Invites = invites
+	data.Form = form
+	app.render(w, status, "account_invites.tmpl", data)
+}
+
+// The validateCollection() helper checks the fields of a collection form.
+func validateCollection(form *collectionForm) {
+	form.CheckField(validator.NotBlank(form.Title), "title", "must not be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "must not be more than 100 characters")
+	form.CheckField(validator.MaxChars(form.Description, 1000), "description", "must not be more than 1000 characters")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.Visibilities...), "visibility", "must be public, unlisted or private")
+}
+
+// The validateComment() helper checks the content of a comment form.
+func validateComment(form *commentForm) {
+	form.CheckField(validator.NotBlank(form.Content), "content", "must not be blank")
+	form.CheckField(validator.MaxChars(form.Content, maxCommentChars), "content", fmt.Sprintf("must not be more than %d characters", maxCommentChars))
+}
+
+// maxCommentChars is the longest a comment can be.
+const maxCommentChars = 2000
+
+// The forkSource() helper fetches the snippet with the given slug so that it can be forked.
+// It returns models.ErrNoRecord if there's no such snippet, or if the user can't fork it.
+func (app *application) forkSource(r *http.Request, slug string) (*models.Snippet, error) {
+	if !validator.Matches(slug, models.SlugRX) {
+		return nil, models.ErrNoRecord
+	}
+
+	snippet, err := app.snippets.GetBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if !app.canFork(r, snippet) {
+		return nil, models.ErrNoRecord
+	}
+
+	return snippet, nil
+}
+
+// The historySnippetFromParams() helper fetches the snippet for the history and diff pages, in the same way as snippetFromParams().
+// Snippets which are burned after reading have no history to show, because that would reveal them without burning them.
+// Password-protected snippets must be unlocked first, so in that case the user is sent to the snippet page to enter the password.
+func (app *application) historySnippetFromParams(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet, ok := app.snippetFromParams(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if snippet.BurnAfterReading {
+		app.notFound(w)
+		return nil, false
+	}
+
+	if !app.isUnlocked(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// The renderUnlockForm() helper renders the form for entering the password for a protected snippet.
+// The page is never cached, and only includes the snippet's slug -- not its title or content.
+func (app *application) renderUnlockForm(w http.ResponseWriter, r *http.Request, status int, snippet *models.Snippet, form snippetUnlockForm) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	data := app.newTemplateData(r)
+	data.Snippet = &models.Snippet{Slug: snippet.Slug}
+	data.Form = form
+	app.render(w, status, "unlock.tmpl", data)
+}
+
+// The snippetFromParams() helper fetches the snippet identified by the "slug" parameter in the URL, so long as the current user is allowed to view it.
+// If the snippet doesn't exist or can't be viewed it sends a 404 Not Found response (so as not to reveal whether the snippet exists) and returns false.
+func (app *application) snippetFromParams(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	// Check the format of the slug before going to the database.
+	if !validator.Matches(slug, models.SlugRX) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	snippet, err := app.snippets.GetBySlug(slug)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	if !app.canView(r, snippet) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// legacyIDRX matches old-style numeric snippet IDs. We can't just check whether strconv.Atoi() accepts the slug, because it also accepts
+// a leading sign, and slugs can start with a "-".
+var legacyIDRX = regexp.MustCompile(`^[0-9]+$`)
+
+// The redirectLegacySnippetURL() helper sends a permanent redirect from an old-style numeric snippet URL to the snippet's new slug-based URL.
+// This is only done for public snippets; for everything else we send a 404 Not Found response.
+func (app *application) redirectLegacySnippetURL(w http.ResponseWriter, r *http.Request, id int) {
+	if id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if snippet.Visibility != models.VisibilityPublic {
+		app.notFound(w)
+		return
+	}
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusMovedPermanently)
+}
+
+// The profileFromParams() helper fetches the user whose username is in the "username" route parameter, for the pages under /u/.
+// If the user doesn't exist or has been disabled, it sends a 404 Not Found response. If the URL isn't the canonical one for the user,
+// it redirects to the canonical URL with the given suffix (like "/starred") added. In either case, it returns false.
+func (app *application) profileFromParams(w http.ResponseWriter, r *http.Request, suffix string) (*models.User, bool) {
+	username := httprouter.ParamsFromContext(r.Context()).ByName("username")
+
+	// Profiles used to be identified by user ID. Usernames can't be all digits, so if we get a number, redirect the old URL to the new one.
+	if id, err := strconv.Atoi(username); err == nil {
+		app.redirectLegacyProfileURL(w, r, id, suffix)
+		return nil, false
+	}
+
+	user, err := app.users.GetByUsername(username)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	// Disabled accounts don't have a profile.
+	if user.Disabled {
+		app.notFound(w)
+		return nil, false
+	}
+
+	// Usernames are case-insensitive, so redirect to the canonical lowercase URL if the username was typed differently.
+	if username != user.Username {
+		http.Redirect(w, r, "/u/"+user.Username+suffix, http.StatusMovedPermanently)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// The redirectLegacyProfileURL() helper permanently redirects an old profile URL, which identified the user by ID, to their username-based URL.
+func (app *application) redirectLegacyProfileURL(w http.ResponseWriter, r *http.Request, id int, suffix string) {
+	if id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if user.Disabled {
+		app.notFound(w)
+		return
+	}
+
+	http.Redirect(w, r, "/u/"+user.Username+suffix, http.StatusMovedPermanently)
+}
+
+// The clientIP() helper returns the IP address of the client which made the request.
+// Note that we deliberately don't trust the X-Forwarded-For header here, because it can be set to anything by the client.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// The rateLimitKey() helper returns the key used to identify the client for rate limiting purposes.
+// Authenticated users are identified by their user ID, so that they share a single limit across all of their devices, and everyone else by their IP address.
+func (app *application) rateLimitKey(r *http.Request) string {
+	if app.isAuthenticated(r) {
+		return fmt.Sprintf("user:%d", app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	}
+	return "ip:" + clientIP(r)
+}
+
+// The logout() helper logs out the user making the request.
+func (app *application) logout(r *http.Request) error {
+	// Forget about the old session token, since it won't be valid any more once it's been renewed.
+	err := app.sessions.Delete(app.sessionManager.Token(r.Context()))
+	if err != nil {
+		return err
+	}
+
+	// Use the RenewToken() method on the current session to change the session ID again.
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	// Remove the authenticatedUserID from the session data so that the user is 'logged out', and go back to a non-persistent session cookie.
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.RememberMe(r.Context(), false)
+	return nil
+}
+
+// The startSession() helper logs in the user making the request as the user with the given ID.
+func (app *application) startSession(r *http.Request, userID int, rememberMe bool) error {
+	// Use the RenewToken() method on the current session to change the session ID.
+	// It's good practice to generate a new session ID when the authentication state or privilege levels changes for the user (e.g. login and logout operations).
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+	// Add the ID of the current user to the session, so that they are now 'logged in'.
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", userID)
+
+	// If the user ticked "Remember me", make the session cookie persistent and extend the session to the longer lifetime.
+	// Note that this must come after RenewToken(), which resets the session deadline to the default lifetime.
+	if rememberMe {
+		app.sessionManager.RememberMe(r.Context(), true)
+		app.sessionManager.SetDeadline(r.Context(), time.Now().Add(app.rememberMe).UTC())
+	}
+
+	// Record that the new session token belongs to this user, so that it shows up on their account page and can be logged out remotely.
+	return app.sessions.Insert(app.sessionManager.Token(r.Context()), userID, clientIP(r), r.UserAgent())
+}
+
+// The renderLoginError() helper re-displays the login page with an error message, for when logging in with single sign-on doesn't work.
+func (app *application) renderLoginError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	form := userLoginForm{}
+	form.AddNonFieldError(message)
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, status, "login.tmpl", data)
+}
+
+// The oidcUser() helper finds the user who has just logged in with single sign-on, and returns their ID.
+// If they've logged in with the same account before, they're already linked to a user. Otherwise, if the provider has verified their email address
+// and we have a user with that address, we link the account to them; and if we don't, we sign them up -- so long as registration is open to them.
+// If the user can't log in, it sends the response itself and returns false.
+func (app *application) oidcUser(w http.ResponseWriter, r *http.Request, issuer, subject string, claims *oidcClaims) (int, bool) {
+	id, err := app.identities.UserID(issuer, subject)
+	if err == nil {
+		user, err := app.users.Get(id)
+		if err != nil {
+			app.serverError(w, err)
+			return 0, false
+		}
+		return app.oidcEnabledUser(w, r, user)
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return 0, false
+	}
+
+	// Anyone can put any email address on an account at some providers, so we can only trust addresses the provider has checked.
+	// Otherwise someone could take over a user's account by creating an account elsewhere with their email address.
+	email := strings.ToLower(claims.Email)
+	if !claims.EmailVerified || !validator.Matches(email, validator.EmailRX) {
+		app.renderLoginError(w, r, http.StatusUnauthorized, "Your email address at "+app.oidc.name+" hasn't been verified, so it can't be used to log in")
+		return 0, false
+	}
+
+	user, err := app.users.GetByEmail(email)
+	if err == nil {
+		err = app.identities.Link(user.ID, issuer, subject)
+		if err != nil {
+			app.serverError(w, err)
+			return 0, false
+		}
+		return app.oidcEnabledUser(w, r, user)
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return 0, false
+	}
+
+	// Signing up with single sign-on follows the same rules as the signup form, except that there's nowhere to give an invite.
+	switch {
+	case app.registration.mode == registrationClosed:
+		app.renderSignupClosed(w, r, "Registration is closed. Ask an administrator if you need an account.")
+		return 0, false
+	case app.registration.mode == registrationInvite:
+		app.renderSignupClosed(w, r, "Registration is by invitation only. Ask an existing user to invite you.")
+		return 0, false
+	case app.registration.mode == registrationDomains && !emailDomainAllowed(email, app.registration.domains):
+		app.renderSignupClosed(w, r, "Only email addresses at "+strings.Join(app.registration.domains, " or ")+" can be used to sign up.")
+		return 0, false
+	}
+
+	name := strings.TrimSpace(claims.Name)
+	username := usernameFromClaims(claims)
+	if name == "" {
+		name = username
+	}
+
+	// If the username has already been taken, try a few more with a random number on the end.
+	for attempt := 1; ; attempt++ {
+		id, err = app.users.InsertExternal(name, username, email)
+		if errors.Is(err, models.ErrDuplicateUsername) && attempt < 5 {
+			username = withRandomSuffix(usernameFromClaims(claims))
+			continue
+		}
+		break
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return 0, false
+	}
+
+	err = app.identities.Link(id, issuer, subject)
+	if err != nil {
+		app.serverError(w, err)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// The oidcEnabledUser() helper returns the ID of a user who has logged in with single sign-on, unless their account has been disabled.
+// Disabled users can't log in with single sign-on any more than they can with a password.
+func (app *application) oidcEnabledUser(w http.ResponseWriter, r *http.Request, user *models.User) (int, bool) {
+	if user.Disabled {
+		app.renderLoginError(w, r, http.StatusForbidden, "Your account has been disabled")
+		return 0, false
+	}
+	return user.ID, true
+}
+
+// The revokeSession() helper logs out a session other than the current one, by deleting it from the session store.
+// The next time a request is made using that session token it won't be found, and the user will be treated as logged out.
+func (app *application) revokeSession(token string) error {
+	err := app.sessionManager.Store.Delete(token)
+	if err != nil {
+		return err
+	}
+	return app.sessions.Delete(token)
+}
+
+// The renderCreateForm() helper renders the form for creating a new snippet, along with the expiry periods which the user is allowed to choose.
+func (app *application) renderCreateForm(w http.ResponseWriter, r *http.Request, status int, form snippetCreateForm) {
+	// The form always shows at least one file.
+	if len(form.Files) == 0 {
+		form.Files = []*models.File{{}}
+	}
+
+	// Users who are members of any organizations can create snippets which belong to one of them.
+	orgs, err := app.orgs.ForUser(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Orgs = orgs
+	data.ExpiryOptions = app.expiryOptions(app.authenticatedUser(r))
+	data.Languages = highlight.Languages
+	app.render(w, status, "create.tmpl", data)
+}
+
+// maxFiles is the largest number of files allowed in a snippet.
+const maxFiles = 10
+
+// The filesFromPostForm() helper reads the files from the create snippet form. Each file has a "filename", "language" and "content" field,
+// so the values of those fields are paired up by their position in the form.
+func filesFromPostForm(r *http.Request) []*models.File {
+	names := r.PostForm["filename"]
+	languages := r.PostForm["language"]
+
+	files := []*models.File{}
+	for i, content := range r.PostForm["content"] {
+		file := &models.File{Content: content}
+		if i < len(names) {
+			file.Name = strings.TrimSpace(names[i])
+		}
+		if i < len(languages) {
+			file.Language = languages[i]
+		}
+		files = append(files, file)
+	}
+
+	// If there's no content field at all, treat it as a single empty file so that the usual "must not be blank" error is shown.
+	if len(files) == 0 {
+		files = append(files, &models.File{})
+	}
+
+	return files
+}
+
+// The checkFiles() helper checks the files from the create or edit snippet form, using field error keys which include the position of the file, like "content.0".
+// If encrypted is true, the content of each file must also look like it was encrypted by the browser.
+func checkFiles(v *validator.Validator, files []*models.File, encrypted bool) {
+	v.CheckField(len(files) <= maxFiles, "files", fmt.Sprintf("must not have more than %d files", maxFiles))
+
+	names := map[string]bool{}
+	for i, file := range files {
+		v.CheckField(validator.NotBlank(file.Content), fmt.Sprintf("content.%d", i), "must not be blank")
+		// Encrypted snippets are encrypted by the browser before the form is submitted, so all we can do is check that the content looks like ciphertext.
+		// This stops plaintext being stored by mistake if the script didn't run.
+		if encrypted && validator.NotBlank(file.Content) {
+			v.CheckField(validator.Matches(file.Content, models.EncryptedContentRX), fmt.Sprintf("content.%d", i), "must be encrypted in the browser -- please make sure JavaScript is enabled")
+		}
+		v.CheckField(validator.MaxChars(file.Name, 100), fmt.Sprintf("name.%d", i), "must not be more than 100 characters")
+		v.CheckField(file.Name == "" || models.ValidFileName(file.Name), fmt.Sprintf("name.%d", i), "must not contain slashes")
+		v.CheckField(!names[file.DisplayName(i)], fmt.Sprintf("name.%d", i), "must be different from the other files")
+		v.CheckField(highlight.ValidLanguage(file.Language), fmt.Sprintf("language.%d", i), "must be one of the listed languages")
+		names[file.DisplayName(i)] = true
+	}
+}
+
+// The diffFiles() helper works out the changes to each file between two revisions, for the given view ("unified" or "split").
+// Files are matched up by name, so a renamed file shows up as one file being removed and another being added. Files which haven't changed are left out.
+func diffFiles(from, to []*models.File, view string) ([]*fileDiff, error) {
+	old := map[string]string{}
+	for i, f := range from {
+		old[f.DisplayName(i)] = f.Content
+	}
+
+	// diffFile() fills in the changes between two versions of a file. Files which are completely different would take too long
+	// (and too much memory) to diff, so we just say so instead.
+	diffFile := func(fd *fileDiff, a, b string) error {
+		lines, err := diff.Lines(diff.SplitLines(a), diff.SplitLines(b))
+		switch {
+		case errors.Is(err, diff.ErrTooDifferent):
+			fd.TooDifferent = true
+		case err != nil:
+			return err
+		case view == "split":
+			fd.Rows = diff.SideBySide(lines)
+		default:
+			fd.Hunks = diff.Unified(lines, 3)
+		}
+		return nil
+	}
+
+	diffs := []*fileDiff{}
+	seen := map[string]bool{}
+
+	for i, f := range to {
+		name := f.DisplayName(i)
+		seen[name] = true
+
+		content, ok := old[name]
+		if ok && content == f.Content {
+			continue
+		}
+
+		fd := &fileDiff{Name: name, Added: !ok}
+		err := diffFile(fd, content, f.Content)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, fd)
+	}
+
+	for i, f := range from {
+		name := f.DisplayName(i)
+		if seen[name] {
+			continue
+		}
+
+		fd := &fileDiff{Name: name, Removed: true}
+		err := diffFile(fd, f.Content, "")
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, fd)
+	}
+
+	return diffs, nil
+}
+
+// An expiryOption is one of the preset expiry periods shown on the create snippet form.
+type expiryOption struct {
+	Value string
+	Label string
+}
+
+// expiryPresets lists the preset expiry periods, shortest first. The values are in the format accepted by parseExpiryDuration().
+var expiryPresets = []expiryOption{
+	{Value: "10m", Label: "Ten Minutes"},
+	{Value: "1h", Label: "One Hour"},
+	{Value: "1d", Label: "One Day"},
+	{Value: "7d", Label: "One Week"},
+	{Value: "30d", Label: "One Month"},
+	{Value: "365d", Label: "One Year"},
+}
+
+var expiryDurationRX = regexp.MustCompile(`^([0-9]{1,6})([mhdw])$`)
+
+// maxExpiryDuration is the longest expiry period which can be entered, even by users who are exempt from the maximum expiry period.
+// Without it a period like "999999w" would overflow a time.Duration. Users who want a snippet to last longer can choose "never".
+const maxExpiryDuration = 10 * 365 * 24 * time.Hour
+
+// Define the errors returned by parseExpiryDuration().
+var (
+	errInvalidExpiry = errors.New("invalid expiry period")
+	errExpiryTooLong = errors.New("expiry period too long")
+)
+
+// The parseExpiryDuration() helper parses an expiry period made up of a number and a unit of minutes (m), hours (h), days (d) or weeks (w), like "90m" or "3d".
+// Unlike time.ParseDuration() it understands days and weeks, and doesn't accept anything shorter than a minute or longer than maxExpiryDuration.
+func parseExpiryDuration(s string) (time.Duration, error) {
+	matches := expiryDurationRX.FindStringSubmatch(strings.TrimSpace(s))
+	if matches == nil {
+		return 0, errInvalidExpiry
+	}
+
+	n, err := strconv.Atoi(matches[1])
+	if err != nil || n == 0 {
+		return 0, errInvalidExpiry
+	}
+
+	units := map[string]time.Duration{
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+
+	// Check the limit before multiplying, so that the multiplication can't overflow.
+	unit := units[matches[2]]
+	if n > int(maxExpiryDuration/unit) {
+		return 0, errExpiryTooLong
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// The humanDuration() helper formats a duration for use in messages, in whole days where possible.
+func humanDuration(d time.Duration) string {
+	switch {
+	case d == 24*time.Hour:
+		return "1 day"
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	default:
+		return d.String()
+	}
+}
+
+// The unlimitedExpiry() helper returns true if the user is exempt from the maximum expiry period, and can create snippets which never expire.
+func (app *application) unlimitedExpiry(user *models.User) bool {
+	return app.expiry.max == 0 || user.HasRole(app.expiry.unlimitedRole)
+}
+
+// The expiryOptions() helper returns the preset expiry periods which the user is allowed to choose, including "never" if they're exempt from the maximum.
+func (app *application) expiryOptions(user *models.User) []expiryOption {
+	options := []expiryOption{}
+
+	for _, option := range expiryPresets {
+		d, _ := parseExpiryDuration(option.Value)
+		if app.unlimitedExpiry(user) || d <= app.expiry.max {
+			options = append(options, option)
+		}
+	}
+
+	if app.unlimitedExpiry(user) {
+		options = append(options, expiryOption{Value: "never", Label: "Never"})
+	}
+
+	return options
+}
+
+// The expiryFromForm() helper works out when a new snippet should expire from the create snippet form, returning nil if it should never expire.
+// Any problems -- including the expiry being longer than the user is allowed -- are added to the form as field errors.
+func (app *application) expiryFromForm(form *snippetCreateForm, user *models.User) *time.Time {
+	now := time.Now().UTC()
+	var expires time.Time
+
+	switch form.Expires {
+	case "never":
+		form.CheckField(app.unlimitedExpiry(user), "expires", "you're not allowed to create snippets which never expire")
+		return nil
+	case "date":
+		// The datetime-local input doesn't include a timezone, so we adjust it using the browser's offset from UTC.
+		t, err := time.ParseInLocation("2006-01-02T15:04", form.ExpiresAt, time.UTC)
+		if err != nil || form.TimezoneOffset < -24*60 || form.TimezoneOffset > 24*60 {
+			form.AddFieldError("expires", "must be a valid date and time")
+			return nil
+		}
+		expires = t.Add(time.Duration(form.TimezoneOffset) * time.Minute)
+	case "duration":
+		d, err := parseExpiryDuration(form.ExpiresIn)
+		if errors.Is(err, errExpiryTooLong) {
+			form.AddFieldError("expires", fmt.Sprintf("is too far in the future -- it must not be more than %s away", humanDuration(maxExpiryDuration)))
+			return nil
+		}
+		if err != nil {
+			form.AddFieldError("expires", "must be a number of minutes, hours, days or weeks, like 90m, 36h, 3d or 2w")
+			return nil
+		}
+		expires = now.Add(d)
+	default:
+		d, err := parseExpiryDuration(form.Expires)
+		if err != nil {
+			form.AddFieldError("expires", "must be a valid expiry period")
+			return nil
+		}
+		expires = now.Add(d)
+	}
+
+	form.CheckField(expires.After(now.Add(time.Minute)), "expires", "must be at least a minute in the future")
+	if !app.unlimitedExpiry(user) {
+		form.CheckField(!expires.After(now.Add(app.expiry.max)), "expires", fmt.Sprintf("must not be more than %s away", humanDuration(app.expiry.max)))
+	}
+
+	return &expires
+}
+
+// reservedUsernames can't be chosen at signup, because they could be mistaken for part of the site (or a person in charge of it).
+var reservedUsernames = []string{"about", "account", "admin", "administrator", "api", "help", "login", "logout", "moderator", "root", "signup", "snippet", "snippets", "static", "support", "system", "tags", "user", "users"}
+
+// maxTags is the largest number of tags allowed on a snippet.
+const maxTags = 5
+
+// tagCloudSize is the number of tags shown in the tag cloud on the home page, and pageSize is the number of snippets listed on each page of
+// a paginated list, like the snippets with a tag or the snippets created by a user.
+const (
+	tagCloudSize = 30
+	pageSize     = 20
+)
+
+// maxPage is the highest page number accepted in the "page" query string parameter. It's far beyond the end of any real list,
+// but small enough that the offset of the page can't overflow.
+const maxPage = 100000
+
+// mostStarredSize is the number of snippets shown in the "most starred this week" section of the home page.
+const mostStarredSize = 5
+
+// Define a pagination type to hold the details needed to render the links between the pages of a list.
+type pagination struct {
+	Path    string // the path of the list, which the page number is added to as a query string parameter
+	Page    int    // the current page, starting from 1
+	PerPage int
+	Total   int // the total number of items in the list
+}
+
+func newPagination(path string, page, perPage, total int) *pagination {
+	return &pagination{Path: path, Page: page, PerPage: perPage, Total: total}
+}
+
+// URL() returns the URL of the given page of the list.
+func (p *pagination) URL(page int) string {
+	if page == 1 {
+		return p.Path
+	}
+	return p.Path + "?page=" + strconv.Itoa(page)
+}
+
+// Pages() returns the number of pages in the list. An empty list still has one (empty) page.
+func (p *pagination) Pages() int {
+	return max(1, (p.Total+p.PerPage-1)/p.PerPage)
+}
+
+func (p *pagination) HasPrevious() bool {
+	return p.Page > 1
+}
+
+func (p *pagination) HasNext() bool {
+	return p.Page < p.Pages()
+}
+
+func (p *pagination) Previous() int {
+	return p.Page - 1
+}
+
+func (p *pagination) Next() int {
+	return p.Page + 1
+}
+
+// The pageFromQuery() helper reads the page number from the "page" query string parameter, defaulting to the first page.
+// It returns an error if the page number isn't a positive integer, or is greater than maxPage.
+func pageFromQuery(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("page")
+	if value == "" {
+		return 1, nil
+	}
+
+	page, err := strconv.Atoi(value)
+	if err != nil || page < 1 || page > maxPage {
+		return 0, errors.New("invalid page number")
+	}
+
+	return page, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"flag"
@@ -8,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/mysqlstore"
@@ -15,6 +17,8 @@ import (
 	"github.com/go-playground/form/v4"
 	_ "github.com/go-sql-driver/mysql"
 	"snippetbox.linze.me/internal/models"
+	"snippetbox.linze.me/internal/ratelimit"
+	"snippetbox.linze.me/internal/validator"
 )
 
 // Define an application struct to hold the application-wide dependencies for the
@@ -30,9 +34,55 @@ type application struct {
 	// users *models.UserModel
 	snippets       models.SnippetModelInterface
 	users          models.UserModelInterface
+	sessions       models.SessionModelInterface
+	comments       models.CommentModelInterface
+	collections    models.CollectionModelInterface
+	orgs           models.OrgModelInterface
+	invites        models.InviteModelInterface
+	identities     models.IdentityModelInterface
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+	limiters       rateLimiters
+	expiry         expiryPolicy
+	registration   registrationPolicy
+	// oidc is the OpenID Connect provider users can log in with, or nil if single sign-on isn't set up.
+	oidc *oidcProvider
+	// rememberMe is the lifetime of the session when a user ticks "Remember me" as they log in.
+	rememberMe time.Duration
+}
+
+// Define an expiryPolicy struct to hold the limits on how long snippets can be kept for.
+type expiryPolicy struct {
+	max           time.Duration // the longest expiry period most users can choose, or 0 for no limit
+	unlimitedRole string        // users with at least this role can choose any expiry period, including never
+}
+
+// Define a registrationPolicy struct to hold the rules for who can sign up.
+type registrationPolicy struct {
+	mode        string   // one of the registrationModes
+	domains     []string // the email domains which can be used to sign up without an invite, when the mode is "domains"
+	userInvites bool     // whether users other than admins can create invites
+}
+
+// Define the registration modes. In every mode except "closed", a valid invite lets someone sign up,
+// whatever their email address.
+const (
+	registrationOpen    = "open"    // anyone can sign up
+	registrationInvite  = "invite"  // only people with an invite can sign up
+	registrationDomains = "domains" // only people with an email address at one of the allowed domains can sign up
+	registrationClosed  = "closed"  // nobody can sign up
+)
+
+var registrationModes = []string{registrationOpen, registrationInvite, registrationDomains, registrationClosed}
+
+// Define a rateLimiters struct to hold the limiter for each group of routes that we want to throttle.
+// The limiters are applied to the route groups in routes.go.
+type rateLimiters struct {
+	dynamic ratelimit.Limiter // every page on the site
+	auth    ratelimit.Limiter // signup and login attempts
+	create  ratelimit.Limiter // snippet creation
+	unlock  ratelimit.Limiter // password guesses for protected snippets
 }
 
 func main() {
@@ -44,6 +94,33 @@ func main() {
 	// Define a new command-line flag for the MySQL DSN string.
 	dsn := flag.String("dsn", "web:12345678@/snippetbox?parseTime=true", "MySQL data source name")
 
+	// Define command-line flags for the rate limits applied to each group of routes.
+	limitDynamic := flag.Int("limit-dynamic", 120, "Maximum page requests per minute from a single client")
+	limitAuth := flag.Int("limit-auth", 10, "Maximum signup and login attempts per minute from a single client")
+	limitCreate := flag.Int("limit-create", 30, "Maximum snippets created per hour by a single user")
+	limitUnlock := flag.Int("limit-unlock", 5, "Maximum password guesses for protected snippets per minute from a single client")
+
+	// Define command-line flags for the session lifetimes.
+	sessionLifetime := flag.Duration("session-lifetime", 12*time.Hour, "Lifetime of a login session")
+	rememberLifetime := flag.Duration("remember-lifetime", 30*24*time.Hour, "Lifetime of a login session when \"Remember me\" is ticked")
+	sessionIdle := flag.Duration("session-idle", 7*24*time.Hour, "Log out sessions which have been inactive for this long (0 to disable)")
+
+	// Define command-line flags for the snippet expiry policy.
+	maxExpiry := flag.Duration("max-expiry", 365*24*time.Hour, "Longest expiry period for snippets (0 for no limit)")
+	unlimitedExpiryRole := flag.String("unlimited-expiry-role", models.RoleAdmin, "Users with at least this role can create snippets with any expiry, including never")
+
+	// Define command-line flags for who can sign up.
+	registration := flag.String("registration", registrationOpen, "Who can sign up (one of: open, invite, domains, closed)")
+	allowedDomains := flag.String("registration-domains", "", "Comma-separated email domains which can sign up when -registration is domains, like example.com")
+	userInvites := flag.Bool("user-invites", false, "Let all users create invites, not just admins")
+
+	// Define command-line flags for single sign-on. It's only enabled if an issuer is given.
+	oidcIssuer := flag.String("oidc-issuer", "", "OpenID Connect issuer URL to let users log in with, like https://accounts.google.com")
+	oidcClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	oidcClientSecret := flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	oidcRedirectURL := flag.String("oidc-redirect-url", "", "OpenID Connect redirect URL, like https://snippetbox.example.com/user/login/oidc/callback")
+	oidcName := flag.String("oidc-name", "SSO", "Name of the OpenID Connect provider, shown as \"Log in with <name>\"")
+
 	// Importantly, we use the flag.Parse() function to parse the command-line flag.
 	// This reads in the command-line flag value and assigns it to the addr
 	// variable. You need to call this *before* you use the addr variable
@@ -63,6 +140,32 @@ func main() {
 	// file name and line number.
 	errLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	// A limit of zero would mean the bucket never refills, so nobody could ever use those routes.
+	for name, limit := range map[string]int{"limit-dynamic": *limitDynamic, "limit-auth": *limitAuth, "limit-create": *limitCreate, "limit-unlock": *limitUnlock} {
+		if limit <= 0 {
+			errLog.Fatalf("invalid -%s %d (must be greater than 0)", name, limit)
+		}
+	}
+
+	if !validator.PermittedValue(*unlimitedExpiryRole, models.Roles...) {
+		errLog.Fatalf("invalid -unlimited-expiry-role %q (must be one of %s)", *unlimitedExpiryRole, strings.Join(models.Roles, ", "))
+	}
+
+	if !validator.PermittedValue(*registration, registrationModes...) {
+		errLog.Fatalf("invalid -registration %q (must be one of %s)", *registration, strings.Join(registrationModes, ", "))
+	}
+
+	// Domains are compared case-insensitively, so we store them in lowercase.
+	var domains []string
+	for _, domain := range strings.Split(*allowedDomains, ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	if *registration == registrationDomains && len(domains) == 0 {
+		errLog.Fatal("-registration-domains must be set when -registration is domains")
+	}
+
 	// To keep the main() function tidy I've put the code for creating a connection
 	// pool into the separate openDB() function below. We pass openDB() the DSN
 	// from the command-line flag.
@@ -75,6 +178,18 @@ func main() {
 	// before the main() function exits.
 	defer db.Close()
 
+	// Fetch the identity provider's configuration now, so that a mistake in the flags is found at startup rather than when someone tries to log in.
+	var sso *oidcProvider
+	if *oidcIssuer != "" {
+		if *oidcClientID == "" || *oidcRedirectURL == "" {
+			errLog.Fatal("-oidc-client-id and -oidc-redirect-url must be set when -oidc-issuer is")
+		}
+		sso, err = newOIDCProvider(context.Background(), *oidcName, *oidcIssuer, *oidcClientID, *oidcClientSecret, *oidcRedirectURL)
+		if err != nil {
+			errLog.Fatal(err)
+		}
+	}
+
 	// Initialize a new template cache...
 	templateCache, err := newTemplateCache()
 	if err != nil {
@@ -88,10 +203,23 @@ func main() {
 	// Then we configure it to use our MySQL database as the session store, and set a lifetime of 12 hours (so that sessions automatically expire 12 hours after first being created).
 	sessionManager := scs.New()
 	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Lifetime = *sessionLifetime
+	// Sessions which haven't been used for a while are expired early, even if they were created with a long lifetime.
+	sessionManager.IdleTimeout = *sessionIdle
 	// Make sure that the Secure attribute is set on our session cookies.
 	// Setting this means that the cookie will only be sent by a user's web browser when a HTTPS connection is being used (and won't be sent over an unsecure HTTP connection).
 	sessionManager.Cookie.Secure = true
+	// By default the session cookie is deleted when the browser is closed. It's only made persistent when the user ticks "Remember me" as they log in.
+	sessionManager.Cookie.Persist = false
+
+	// Initialize an in-memory token-bucket limiter for each group of routes, and start a background goroutine for each which periodically removes stale buckets.
+	dynamicLimiter := ratelimit.NewMemory(*limitDynamic, time.Minute, *limitDynamic)
+	authLimiter := ratelimit.NewMemory(*limitAuth, time.Minute, *limitAuth)
+	createLimiter := ratelimit.NewMemory(*limitCreate, time.Hour, *limitCreate)
+	unlockLimiter := ratelimit.NewMemory(*limitUnlock, time.Minute, *limitUnlock)
+	for _, limiter := range []*ratelimit.Memory{dynamicLimiter, authLimiter, createLimiter, unlockLimiter} {
+		defer limiter.StartCleanup(time.Minute)()
+	}
 
 	// Initialize a new instance of our application struct, containing the
 	// dependencies.
@@ -102,9 +230,41 @@ func main() {
 		errLog:         errLog,
 		snippets:       &models.SnippetModel{DB: db},
 		users:          &models.UserModel{DB: db},
+		sessions:       &models.SessionModel{DB: db},
+		comments:       &models.CommentModel{DB: db},
+		collections:    &models.CollectionModel{DB: db},
+		orgs:           &models.OrgModel{DB: db},
+		invites:        &models.InviteModel{DB: db},
+		identities:     &models.IdentityModel{DB: db},
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		rememberMe:     *rememberLifetime,
+		expiry: expiryPolicy{
+			max:           *maxExpiry,
+			unlimitedRole: *unlimitedExpiryRole,
+		},
+		registration: registrationPolicy{
+			mode:        *registration,
+			domains:     domains,
+			userInvites: *userInvites,
+		},
+		oidc: sso,
+		limiters: rateLimiters{
+			dynamic: dynamicLimiter,
+			auth:    authLimiter,
+			create:  createLimiter,
+			unlock:  unlockLimiter,
+		},
+	}
+
+	// If any arguments were given after the flags, run them as a management command (like "user promote <email> <role>") instead of starting the server.
+	if flag.NArg() > 0 {
+		err = app.runCommand(os.Stdout, flag.Args())
+		if err != nil {
+			errLog.Fatal(err)
+		}
+		return
 	}
 
 	// Initialize a tls.Config struct to hold the non-default TLS settings we want the server to use.
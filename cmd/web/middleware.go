@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/justinas/alice"
 	"github.com/justinas/nosurf"
+	"snippetbox.linze.me/internal/models"
+	"snippetbox.linze.me/internal/ratelimit"
 )
 
 func secureHeaders(next http.Handler) http.Handler {
@@ -62,6 +68,26 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// The requireRole() method returns a middleware which only lets through users who have the given role (or a more privileged one).
+// Unauthenticated users are redirected to the login page, and authenticated users without the role get a 403 Forbidden response.
+func (app *application) requireRole(role string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.isAuthenticated(r) {
+				http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+				return
+			}
+
+			if !app.authenticatedUser(r).HasRole(role) {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Create a NoSurf middleware function which uses a customized CSRF cookie with the Secure, Path and HttpOnly attributes set.
 func noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
@@ -84,20 +110,69 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		// Otherwise, we check to see if a user with that ID exists in our database.
-		exists, err := app.users.Exists(id)
+		// Otherwise, we fetch the user with that ID from our database.
+		// If there's no matching user (for example, because the account has been deleted) we treat the request as unauthenticated.
+		user, err := app.users.Get(id)
 		if err != nil {
-			app.serverError(w, err)
+			if errors.Is(err, models.ErrNoRecord) {
+				next.ServeHTTP(w, r)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		// Likewise if the user's account has been disabled by an admin.
+		if user.Disabled {
+			next.ServeHTTP(w, r)
 			return
 		}
 
 		// If a matching user is found, we know that the request is coming from an authenticated user who exists in our database.
 		// We create a new copy of the request (with an isAuthenticatedContextKey value of true in the request context) and assign it to r.
-		if exists {
-			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
-			r = r.WithContext(ctx)
+		// We also store the user itself in the context, so that handlers and middleware can check their role without another database query,
+		// and likewise their roles in the organizations they're a member of.
+		roles, err := app.orgs.Roles(user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, authenticatedUserContextKey, user)
+		ctx = context.WithValue(ctx, orgRolesContextKey, roles)
+		r = r.WithContext(ctx)
+
+		// Update the last seen time for the session, which is shown on the user's account page.
+		err = app.sessions.Touch(app.sessionManager.Token(r.Context()))
+		if err != nil {
+			app.serverError(w, err)
+			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// The rateLimit() method returns a middleware which throttles requests using the given limiter.
+// Requests are keyed by user ID for authenticated users and by IP address otherwise, so it should be used after the authenticate middleware in a chain.
+// If the limit has been exceeded we send a 429 Too Many Requests response, with a Retry-After header telling the client how many seconds to wait.
+func (app *application) rateLimit(limiter ratelimit.Limiter) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, retryAfter, err := limiter.Allow(app.rateLimitKey(r))
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				app.clientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
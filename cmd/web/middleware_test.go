@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"snippetbox.linze.me/internal/assert"
+	"snippetbox.linze.me/internal/ratelimit"
 )
 
 func TestSecureHeaders(t *testing.T) {
@@ -63,3 +65,43 @@ func TestSecureHeaders(t *testing.T) {
 	bytes.TrimSpace(body)
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Create a limiter which allows a single request per minute, and a mock HTTP handler to pass to the rateLimit middleware.
+	limiter := ratelimit.NewMemory(1, time.Minute, 1)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	handler := app.sessionManager.LoadAndSave(app.rateLimit(limiter)(next))
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		wantCode       int
+		wantRetryAfter string
+	}{
+		{name: "First request", remoteAddr: "192.0.2.1:1234", wantCode: http.StatusOK},
+		{name: "Second request", remoteAddr: "192.0.2.1:5678", wantCode: http.StatusTooManyRequests, wantRetryAfter: "60"},
+		{name: "Different client", remoteAddr: "192.0.2.2:1234", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RemoteAddr = tt.remoteAddr
+
+			handler.ServeHTTP(rr, r)
+
+			rs := rr.Result()
+			assert.Equal(t, rs.StatusCode, tt.wantCode)
+			assert.Equal(t, rs.Header.Get("Retry-After"), tt.wantRetryAfter)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"snippetbox.linze.me/internal/validator"
+)
+
+// Define an oidcProvider struct to hold everything needed to let users log in with an OpenID Connect identity provider,
+// like Google, Okta or Keycloak. We use the authorization code flow: the user is sent to the provider to log in, and the provider
+// sends them back to our callback URL with a code which we exchange for an ID token, signed by the provider, saying who they are.
+type oidcProvider struct {
+	name     string // what the provider is called on the login page, like "Google"
+	config   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// The newOIDCProvider() function fetches the provider's discovery document from {issuer}/.well-known/openid-configuration,
+// which tells us where to send users to log in, where to exchange codes for tokens, and where to find the keys which ID tokens are signed with.
+// The keys themselves are fetched (and cached) the first time an ID token needs to be verified.
+func newOIDCProvider(ctx context.Context, name, issuer, clientID, clientSecret, redirectURL string) (*oidcProvider, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oidcProvider{
+		name: name,
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+// Define an oidcClaims struct to hold the claims we use from an ID token, besides the issuer and subject which identify the account.
+type oidcClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// The randomToken() helper returns a random string for the state and nonce parameters, which tie the provider's response
+// to the browser session that started the login, so that it can't be replayed or forged by someone else.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// The usernameFromClaims() helper picks a username for a user who signs up by logging in with single sign-on, based on their preferred
+// username or the start of their email address. Anything which isn't allowed in a username is dropped, and if what's left still
+// isn't a valid username we fall back to "user-" and a number.
+func usernameFromClaims(claims *oidcClaims) string {
+	username := claims.PreferredUsername
+	if username == "" || strings.Contains(username, "@") {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	username = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r == '.' || r == ' ':
+			return '-'
+		default:
+			return -1
+		}
+	}, strings.ToLower(username))
+	username = strings.TrimLeft(username, "0123456789_-")
+
+	// Leave room for a numeric suffix, in case the username has already been taken.
+	if len(username) > 24 {
+		username = username[:24]
+	}
+
+	if !validator.Matches(username, validator.UsernameRX) || validator.PermittedValue(username, reservedUsernames...) {
+		return withRandomSuffix("user")
+	}
+	return username
+}
+
+// The withRandomSuffix() helper adds a random number to a username, to try again when the username has already been taken.
+func withRandomSuffix(username string) string {
+	n, err := rand.Int(rand.Reader, big.NewInt(100000))
+	if err != nil {
+		n = big.NewInt(0)
+	}
+	return fmt.Sprintf("%s-%d", username, n)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
+	"snippetbox.linze.me/internal/models"
 	"snippetbox.linze.me/ui"
 )
 
@@ -56,7 +57,8 @@ func (app *application) routes() http.Handler {
 	// Create a new middleware chain containing the middleware specific to our dynamic application routes. For now, this chain will only contain the LoadAndSave session middleware but we'll add more to it later.
 	// Unprotected application routes using the "dynamic" middleware chain.
 	// Use the nosurf middleware on all our 'dynamic' routes.
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	// Every dynamic route is also throttled by the general rate limiter.
+	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate, app.rateLimit(app.limiters.dynamic))
 
 	/*
 		// And then create the routes using the appropriate methods, patterns and handlers.
@@ -69,18 +71,74 @@ func (app *application) routes() http.Handler {
 	// Update these routes to use the new dynamic middleware chain followed by the appropriate handler function.
 	// Note that because the alice ThenFunc() method returns a http.Handler (rather than a http.HandlerFunc) we also need to switch to registering the route using the router.Handler() method.
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
-	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/snippet/view/:slug", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodPost, "/snippet/reveal/:slug", dynamic.ThenFunc(app.snippetRevealPost))
+	router.Handler(http.MethodGet, "/snippet/raw/:slug", dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/snippet/download/:slug", dynamic.ThenFunc(app.snippetDownload))
+	router.Handler(http.MethodGet, "/snippet/view/:slug/history", dynamic.ThenFunc(app.snippetHistory))
+	router.Handler(http.MethodGet, "/snippet/view/:slug/diff", dynamic.ThenFunc(app.snippetDiff))
+	router.Handler(http.MethodGet, "/tags/:tag", dynamic.ThenFunc(app.tagView))
+	router.Handler(http.MethodGet, "/collection/:slug", dynamic.ThenFunc(app.collectionView))
+	router.Handler(http.MethodGet, "/org/:slug", dynamic.ThenFunc(app.orgView))
+
+	// User profiles live under /u/ rather than /user/, because httprouter doesn't allow a wildcard like /user/:username alongside /user/signup and /user/login.
+	router.Handler(http.MethodGet, "/u/:username", dynamic.ThenFunc(app.userProfile))
+	router.Handler(http.MethodGet, "/u/:username/starred", dynamic.ThenFunc(app.userStarred))
+
+	// Password guesses for protected snippets are throttled to stop brute-force attacks.
+	router.Handler(http.MethodPost, "/snippet/unlock/:slug", dynamic.Append(app.rateLimit(app.limiters.unlock)).ThenFunc(app.snippetUnlockPost))
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
-	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
-	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+
+	// Signup and login attempts get a much stricter limit of their own, to slow down spam accounts and password guessing.
+	auth := dynamic.Append(app.rateLimit(app.limiters.auth))
+	router.Handler(http.MethodPost, "/user/signup", auth.ThenFunc(app.userSignupPost))
+	router.Handler(http.MethodPost, "/user/login", auth.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodGet, "/user/login/oidc", auth.ThenFunc(app.userLoginOIDC))
+	router.Handler(http.MethodGet, "/user/login/oidc/callback", auth.ThenFunc(app.userLoginOIDCCallback))
 
 	// Protected (authenticated-only) application routes, using a new "protected" middleware chain which includes the requireAuthentication middleware.
 	// Because the 'protected' middleware chain appends to the 'dynamic' chain the noSurf middleware will also be used on the three routes below too.
 	protected := dynamic.Append(app.requireAuthentication)
 	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodPost, "/snippet/create", protected.Append(app.rateLimit(app.limiters.create)).ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodGet, "/snippet/edit/:slug", protected.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/snippet/edit/:slug", protected.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodPost, "/snippet/restore/:slug", protected.ThenFunc(app.snippetRestorePost))
+	router.Handler(http.MethodPost, "/snippet/star/:slug", protected.ThenFunc(app.snippetStarPost))
+	router.Handler(http.MethodPost, "/snippet/comment/:slug", protected.ThenFunc(app.snippetCommentPost))
+	router.Handler(http.MethodGet, "/comment/edit/:id", protected.ThenFunc(app.commentEdit))
+	router.Handler(http.MethodPost, "/comment/edit/:id", protected.ThenFunc(app.commentEditPost))
+	router.Handler(http.MethodPost, "/comment/delete/:id", protected.ThenFunc(app.commentDeletePost))
+	router.Handler(http.MethodPost, "/snippet/collect/:slug", protected.ThenFunc(app.snippetCollectPost))
+	router.Handler(http.MethodGet, "/collection/:slug/edit", protected.ThenFunc(app.collectionEdit))
+	router.Handler(http.MethodPost, "/collection/:slug/edit", protected.ThenFunc(app.collectionEditPost))
+	router.Handler(http.MethodPost, "/collection/:slug/delete", protected.ThenFunc(app.collectionDeletePost))
+	router.Handler(http.MethodPost, "/collection/:slug/arrange", protected.ThenFunc(app.collectionArrangePost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodGet, "/account", protected.ThenFunc(app.accountView))
+	router.Handler(http.MethodGet, "/account/snippets", protected.ThenFunc(app.accountSnippets))
+	router.Handler(http.MethodGet, "/account/collections", protected.ThenFunc(app.accountCollections))
+	router.Handler(http.MethodGet, "/account/collections/create", protected.ThenFunc(app.collectionCreate))
+	router.Handler(http.MethodPost, "/account/collections/create", protected.ThenFunc(app.collectionCreatePost))
+	router.Handler(http.MethodPost, "/org/:slug/members", protected.ThenFunc(app.orgMemberPost))
+	router.Handler(http.MethodPost, "/org/:slug/members/remove", protected.ThenFunc(app.orgMemberRemovePost))
+	router.Handler(http.MethodGet, "/account/orgs", protected.ThenFunc(app.accountOrgs))
+	router.Handler(http.MethodGet, "/account/orgs/create", protected.ThenFunc(app.orgCreate))
+	router.Handler(http.MethodPost, "/account/orgs/create", protected.ThenFunc(app.orgCreatePost))
+	router.Handler(http.MethodGet, "/account/invites", protected.ThenFunc(app.accountInvites))
+	router.Handler(http.MethodPost, "/account/invites/create", protected.ThenFunc(app.accountInviteCreatePost))
+	router.Handler(http.MethodPost, "/account/invites/delete", protected.ThenFunc(app.accountInviteDeletePost))
+	router.Handler(http.MethodPost, "/account/sessions/logout", protected.ThenFunc(app.accountSessionLogoutPost))
+	router.Handler(http.MethodPost, "/account/sessions/logout-all", protected.ThenFunc(app.accountSessionLogoutAllPost))
+
+	// Admin-only routes, using an "admin" middleware chain which only lets through users with the admin role.
+	admin := protected.Append(app.requireRole(models.RoleAdmin))
+	router.Handler(http.MethodGet, "/admin", admin.ThenFunc(app.adminDashboard))
+	router.Handler(http.MethodGet, "/admin/users", admin.ThenFunc(app.adminUsers))
+	router.Handler(http.MethodPost, "/admin/users/disable", admin.ThenFunc(app.adminUserDisablePost))
+	router.Handler(http.MethodGet, "/admin/snippets", admin.ThenFunc(app.adminSnippets))
+	router.Handler(http.MethodPost, "/admin/snippets/delete", admin.ThenFunc(app.adminSnippetDeletePost))
 
 	// Create the middleware chain as normal.
 	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
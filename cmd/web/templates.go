@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"time"
 
+	"snippetbox.linze.me/internal/highlight"
+	"snippetbox.linze.me/internal/markdown"
 	"snippetbox.linze.me/internal/models"
 	"snippetbox.linze.me/ui"
 )
@@ -19,11 +21,103 @@ type templateData struct {
 	Form            any
 	Flash           string
 	IsAuthenticated bool
-	CSRFToken       string
+	// AuthenticatedUser holds the details of the logged-in user, or nil if the user isn't logged in.
+	AuthenticatedUser *models.User
+	CSRFToken         string
+	Sessions          []*models.Session
+	CurrentSessionID  int
+	Users             []*models.User
+	Stats             *instanceStats
+	Query             string
+	ExpiryOptions     []expiryOption
+	CanEdit           bool
+	CanFork           bool
+	Parent            *models.Snippet
+	Revisions         []*models.Revision
+	Diff              *revisionDiff
+	Languages         []highlight.Language
+	Tags              []*models.Tag // the tag cloud
+	Tag               string
+	Pagination        *pagination
+	Profile           *models.User // the user whose profile is being shown
+	Starred           bool         // whether the logged-in user has starred the snippet
+	MostStarred       []*models.Snippet
+	Comments          []*models.Comment
+	Comment           *models.Comment // the comment being edited
+	CanComment        bool
+	EditableComments  map[int]bool  // which of the comments the user can edit or delete, by ID
+	Lines             [][]*codeLine // the highlighted lines of each of the snippet's files, by position
+	Collection        *models.Collection
+	Collections       []*models.Collection
+	CollectionItems   []*collectionItem
+	CanCollect        bool
+	InCollections     map[int]bool // which of the user's collections include the snippet, by ID
+	Org               *models.Org  // the organization being shown, or which owns the snippet
+	Orgs              []*models.Org
+	OrgRole           string // the user's role in the organization, or "" if they aren't a member
+	Members           []*models.Member
+	Invite            *models.Invite // the invite being used to sign up
+	Invites           []*models.Invite
+	CanInvite         bool
+	// RegistrationNotice explains why the user can't sign up, in which case the signup form isn't shown.
+	RegistrationNotice string
+	// OIDCName is the name of the single sign-on provider shown on the login page, or "" if single sign-on isn't set up.
+	OIDCName string
+}
+
+// A collectionItem is a snippet on a collection page. Locked snippets are only shown as a link, without their content.
+type collectionItem struct {
+	Snippet     *models.Snippet
+	Lines       [][]*codeLine
+	Locked      bool
+	First, Last bool // whether the snippet is the first or last one shown, so can't be moved any further up or down
+}
+
+// A codeLine is a single highlighted line of a file on the snippet page, along with the line comments which are shown after it.
+type codeLine struct {
+	highlight.Line
+	Anchor   string // the line's id, which the URL fragment can link to
+	Comments []*models.Comment
+}
+
+// A commentView holds a comment and everything the "comment" partial template needs to know to show it,
+// since a template can only be passed a single value.
+type commentView struct {
+	*models.Comment
+	Slug      string
+	CSRFToken string
+	CanReply  bool
+	CanModify bool
+}
+
+// Create a commentView function which returns the commentView for a comment on the snippet page.
+func newCommentView(data *templateData, comment *models.Comment) commentView {
+	return commentView{
+		Comment:   comment,
+		Slug:      data.Snippet.Slug,
+		CSRFToken: data.CSRFToken,
+		CanReply:  data.CanComment,
+		CanModify: data.EditableComments[comment.ID],
+	}
 }
 
 // Create a humanDate function which returns a nicely formatted string representation of a time.Time object.
-func humanDate(t time.Time) string {
+// It also accepts a *time.Time, so that it can be used for optional times like snippet expiry dates, and returns "Never" if the pointer is nil.
+func humanDate(v any) string {
+	var t time.Time
+
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v == nil {
+			return "Never"
+		}
+		t = *v
+	default:
+		return ""
+	}
+
 	// Return the empty string if time has the zero value.
 	if t.IsZero() {
 		return ""
@@ -36,8 +130,21 @@ func humanDate(t time.Time) string {
 
 // Initialize a template.FuncMap object and store it in a global variable.
 // This is essentially a string-keyed map which acts as a lookup between the names of our custom template functions and the functions themselves.
+// Create a renderMarkdown function which returns the content of a Markdown snippet file as sanitized HTML.
+func renderMarkdown(file *models.File) (template.HTML, error) {
+	return markdown.HTML(file.Content)
+}
+
+// Create a renderComment function which returns the content of a comment as sanitized HTML.
+func renderComment(content string) (template.HTML, error) {
+	return markdown.Comment(content)
+}
+
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"renderComment":  renderComment,
+	"commentView":    newCommentView,
+	"humanDate":      humanDate,
+	"renderMarkdown": renderMarkdown,
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
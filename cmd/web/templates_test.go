@@ -21,7 +21,7 @@ func TestHumanDate(t *testing.T) {
 	// Create a slice of anonymous structs containing the test case name, input to our humanDate() function (the tm field), and expected output (the want field).
 	tests := []struct {
 		name string
-		tm   time.Time
+		tm   any
 		want string
 	}{
 		{
@@ -39,6 +39,16 @@ func TestHumanDate(t *testing.T) {
 			tm:   time.Date(2024, 3, 17, 10, 15, 0, 0, time.FixedZone("CET", 1*60*60)),
 			want: "17 Mar 2024 at 09:15",
 		},
+		{
+			name: "Pointer",
+			tm:   func() *time.Time { t := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC); return &t }(),
+			want: "17 Mar 2024 at 10:15",
+		},
+		{
+			name: "Never",
+			tm:   (*time.Time)(nil),
+			want: "Never",
+		},
 	}
 
 	// Loop over the test cases.
@@ -2,17 +2,30 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html"
 	"io"
 	"log"
+	"math/big"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"snippetbox.linze.me/internal/models"
 	"snippetbox.linze.me/internal/models/mocks"
+	"snippetbox.linze.me/internal/ratelimit"
 )
 
 // Create a newTestApplication helper which returns an instance of our application struct containing mocked dependencies.
@@ -28,16 +41,39 @@ func newTestApplication(t *testing.T) *application {
 	// If no store is set, the SCS package will default to using a transient  in-memory store, which is ideal for testing purposes.
 	sessionManager := scs.New()
 	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.IdleTimeout = 7 * 24 * time.Hour
 	sessionManager.Cookie.Secure = true
+	sessionManager.Cookie.Persist = false
 
 	return &application{
 		errLog:         log.New(io.Discard, "", 0),
 		infoLog:        log.New(io.Discard, "", 0),
 		snippets:       &mocks.SnippetModel{},
 		users:          &mocks.UserModel{},
+		sessions:       &mocks.SessionModel{},
+		comments:       &mocks.CommentModel{},
+		collections:    &mocks.CollectionModel{},
+		orgs:           &mocks.OrgModel{},
+		invites:        &mocks.InviteModel{},
+		identities:     &mocks.IdentityModel{},
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		rememberMe:     30 * 24 * time.Hour,
+		expiry: expiryPolicy{
+			max:           365 * 24 * time.Hour,
+			unlimitedRole: models.RoleAdmin,
+		},
+		registration: registrationPolicy{
+			mode: registrationOpen,
+		},
+		// Use generous rate limits so that they don't get in the way of the other tests.
+		limiters: rateLimiters{
+			dynamic: ratelimit.NewMemory(1000, time.Minute, 1000),
+			auth:    ratelimit.NewMemory(1000, time.Minute, 1000),
+			create:  ratelimit.NewMemory(1000, time.Minute, 1000),
+			unlock:  ratelimit.NewMemory(1000, time.Minute, 1000),
+		},
 	}
 }
 
@@ -86,3 +122,184 @@ func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, strin
 
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// Define a regular expression which captures the CSRF token value from the HTML for our pages.
+var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+)">`)
+
+func extractCSRFToken(t *testing.T, body string) string {
+	// Use the FindStringSubmatch method to extract the token from the HTML body.
+	// Note that this returns an array with the entire matched pattern in the first position, and the values of any captured data in the subsequent positions.
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+
+	// The token is HTML-escaped by html/template when it's rendered, so we need to unescape it.
+	return html.UnescapeString(matches[1])
+}
+
+// Create a postForm method for sending POST requests to the test server.
+// The final parameter to this method is a url.Values object which can contain any form data that you want to send in the request body.
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	rs, err := ts.Client().PostForm(ts.URL+urlPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read the response body from the test server.
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes.TrimSpace(body)
+
+	// Return the response status, headers and body.
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+// The login method logs in as the mock user with the given email address or username (alice@email.com is a regular user, and bob@email.com is an admin),
+// so that any subsequent requests made by the test server client are authenticated.
+func (ts *testServer) login(t *testing.T, login string) {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("login", login)
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+}
+
+// The stubOIDCProvider type is a minimal OpenID Connect identity provider, for testing single sign-on against. There's no login page:
+// instead the test reads the authorization request from where the app redirects to, and calls the callback itself with the code "stub-code".
+type stubOIDCProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string         // the PKCE code challenge from the last authorization request
+	nonce     string         // the nonce from the last authorization request, which is put in the ID token
+	claims    map[string]any // the claims to put in the ID token, besides the standard ones
+}
+
+func newStubOIDCProvider(t *testing.T) *stubOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &stubOIDCProvider{key: key}
+
+	writeJSON := func(w http.ResponseWriter, status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "stub",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	// The token endpoint only accepts the code along with the PKCE verifier which matches the challenge in the authorization request.
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "stub-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		idToken, err := p.idToken()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "stub-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// The idToken() method returns an ID token for the claims, signed with RS256.
+func (p *stubOIDCProvider) idToken() (string, error) {
+	claims := map[string]any{
+		"iss":   p.URL,
+		"aud":   "snippetbox",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": p.nonce,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	signingInput := encode([]byte(`{"alg":"RS256","kid":"stub","typ":"JWT"}`)) + "." + encode(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + encode(signature), nil
+}
+
+// The provider() method sets up single sign-on with the stub provider, calling it "Stub".
+func (p *stubOIDCProvider) provider(t *testing.T, redirectURL string) *oidcProvider {
+	provider, err := newOIDCProvider(context.Background(), "Stub", p.URL, "snippetbox", "secret", redirectURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// The authorize() method stands in for the user logging in at the provider. It takes the URL the app redirected to,
+// and returns the path of the callback which the provider would send the user back to.
+func (p *stubOIDCProvider) authorize(t *testing.T, location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := u.Query()
+	if query.Get("client_id") != "snippetbox" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %q", location)
+	}
+	p.challenge = query.Get("code_challenge")
+	p.nonce = query.Get("nonce")
+
+	callback, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback.Path + "?" + url.Values{"code": {"stub-code"}, "state": {query.Get("state")}}.Encode()
+}
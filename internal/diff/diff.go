@@ -0,0 +1,294 @@
+// Package diff computes line-based differences between two texts, for showing the changes between revisions of a snippet.
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of change made to a line.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// String returns the name of the operation, which is handy for use as a CSS class.
+func (op Op) String() string {
+	switch op {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	default:
+		return "equal"
+	}
+}
+
+// Symbol returns the character used to mark lines with this operation in a unified diff.
+func (op Op) Symbol() string {
+	switch op {
+	case Delete:
+		return "-"
+	case Insert:
+		return "+"
+	default:
+		return " "
+	}
+}
+
+// A Line is a single line of a diff. OldNumber and NewNumber are the 1-based line numbers in the old and new text,
+// and are 0 for lines which don't appear in that text (i.e. inserted and deleted lines respectively).
+type Line struct {
+	Op        Op
+	Text      string
+	OldNumber int
+	NewNumber int
+}
+
+// SplitLines splits a text into lines, treating both "\n" and "\r\n" as line endings. A trailing line ending doesn't start a new, empty line.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// MaxEdits is the largest number of inserted and deleted lines that Lines will find. The memory needed grows with the square of the number of edits,
+// so texts which are more different than this aren't diffed at all.
+const MaxEdits = 1000
+
+// ErrTooDifferent is returned by Lines when the texts need more than MaxEdits insertions and deletions to turn one into the other.
+var ErrTooDifferent = errors.New("diff: texts differ too much")
+
+// Lines returns the shortest sequence of line insertions and deletions which turns a into b, interleaved with the unchanged lines.
+// It uses Myers' O(ND) difference algorithm, so it's fast when the two texts are similar -- which revisions of a snippet usually are.
+// If they need more than MaxEdits insertions and deletions, it gives up and returns ErrTooDifferent.
+func Lines(a, b []string) ([]Line, error) {
+	n, m := len(a), len(b)
+	limit := min(n+m, MaxEdits)
+	offset := limit + 1
+
+	// v[offset+k] holds the furthest x reached on diagonal k. Before each step d we keep a copy of the part of v which that step reads,
+	// diagonals -(d+1) to d+1, so that we can work backwards through the steps afterwards to find the path that was taken.
+	// Copying only that window, rather than all of v, keeps the memory needed proportional to the square of the number of edits.
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // move down, inserting a line from b
+			} else {
+				x = v[offset+k-1] + 1 // move right, deleting a line from a
+			}
+			y := x - k
+
+			// Follow the diagonal for as long as the lines are the same.
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return number(backtrack(trace, a, b)), nil
+			}
+		}
+	}
+
+	// The loop always reaches the end of both texts after at most n+m steps, so we only get here if we gave up first.
+	return nil, ErrTooDifferent
+}
+
+// backtrack() works backwards from the end of both texts to find the edits made at each step, then returns them in order.
+// Each trace[d] holds diagonals -(d+1) to d+1, so diagonal k is at trace[d][d+1+k].
+func backtrack(trace [][]int, a, b []string) []Line {
+	x, y := len(a), len(b)
+	var lines []Line
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		offset := d + 1
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			lines = append(lines, Line{Op: Equal, Text: a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				lines = append(lines, Line{Op: Insert, Text: b[y-1]})
+			} else {
+				lines = append(lines, Line{Op: Delete, Text: a[x-1]})
+			}
+			x, y = prevX, prevY
+		}
+	}
+
+	// The lines were collected from the end backwards, so reverse them.
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+// number() fills in the old and new line numbers for each line.
+func number(lines []Line) []Line {
+	oldNumber, newNumber := 0, 0
+	for i := range lines {
+		if lines[i].Op != Insert {
+			oldNumber++
+			lines[i].OldNumber = oldNumber
+		}
+		if lines[i].Op != Delete {
+			newNumber++
+			lines[i].NewNumber = newNumber
+		}
+	}
+	return lines
+}
+
+// A Hunk is a group of nearby changes in a unified diff, along with some unchanged lines around them for context.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+}
+
+// Header returns the hunk's header in the usual unified diff format, like "@@ -1,4 +1,5 @@".
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Unified groups the changes in a diff into hunks, each including up to context unchanged lines before and after the changes.
+// Changes which are close enough for their context to overlap are put in the same hunk.
+func Unified(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		// Find the end of this group of changes, carrying on through any unchanged runs short enough to be covered by the context.
+		start := max(0, i-context)
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].Op == Equal {
+				next++
+			}
+			if next == len(lines) || next-end > 2*context {
+				break
+			}
+			end = next
+		}
+		end = min(len(lines), end+context)
+
+		hunks = append(hunks, newHunk(lines, start, end))
+		i = end
+	}
+
+	return hunks
+}
+
+// newHunk() creates a hunk from lines[start:end].
+func newHunk(lines []Line, start, end int) Hunk {
+	h := Hunk{Lines: lines[start:end]}
+
+	// Count the lines on each side before the hunk, to work out where it starts.
+	oldBefore, newBefore := 0, 0
+	for _, line := range lines[:start] {
+		if line.Op != Insert {
+			oldBefore++
+		}
+		if line.Op != Delete {
+			newBefore++
+		}
+	}
+
+	for _, line := range h.Lines {
+		if line.Op != Insert {
+			h.OldLines++
+		}
+		if line.Op != Delete {
+			h.NewLines++
+		}
+	}
+
+	// By convention, a hunk with no lines on one side "starts" at the line before the change.
+	h.OldStart, h.NewStart = oldBefore, newBefore
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+
+	return h
+}
+
+// A Row is a single row of a side-by-side diff. Old or New is nil if the row has no line on that side.
+type Row struct {
+	Old *Line
+	New *Line
+}
+
+// SideBySide lays out a diff as rows of old and new lines. Unchanged lines appear on both sides, and runs of deleted lines are
+// paired up with the inserted lines which follow them, so that a changed line appears opposite the line which replaced it.
+func SideBySide(lines []Line) []Row {
+	var rows []Row
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			rows = append(rows, Row{Old: &lines[i], New: &lines[i]})
+			i++
+			continue
+		}
+
+		var deleted, inserted []*Line
+		for ; i < len(lines) && lines[i].Op == Delete; i++ {
+			deleted = append(deleted, &lines[i])
+		}
+		for ; i < len(lines) && lines[i].Op == Insert; i++ {
+			inserted = append(inserted, &lines[i])
+		}
+
+		for j := 0; j < max(len(deleted), len(inserted)); j++ {
+			var row Row
+			if j < len(deleted) {
+				row.Old = deleted[j]
+			}
+			if j < len(inserted) {
+				row.New = inserted[j]
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"snippetbox.linze.me/internal/assert"
+)
+
+// mustLines() returns the diff between two texts, failing the test if they're too different to diff.
+func mustLines(t *testing.T, a, b []string) []Line {
+	lines, err := Lines(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+// render() formats a diff in the familiar unified style, with a prefix of " ", "-" or "+" for each line.
+func render(lines []Line) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line.Op.Symbol() + line.Text + "\n")
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "Identical",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: " a\n b\n",
+		},
+		{
+			name: "Both empty",
+			a:    "",
+			b:    "",
+			want: "",
+		},
+		{
+			name: "From empty",
+			a:    "",
+			b:    "a\nb",
+			want: "+a\n+b\n",
+		},
+		{
+			name: "To empty",
+			a:    "a\nb",
+			b:    "",
+			want: "-a\n-b\n",
+		},
+		{
+			name: "Changed line",
+			a:    "a\nb\nc",
+			b:    "a\nx\nc",
+			want: " a\n-b\n+x\n c\n",
+		},
+		{
+			name: "Windows line endings",
+			a:    "a\r\nb\r\n",
+			b:    "a\nb\nc\n",
+			want: " a\n b\n+c\n",
+		},
+		{
+			name: "Myers example",
+			a:    "A\nB\nC\nA\nB\nB\nA",
+			b:    "C\nB\nA\nB\nA\nC",
+			want: "-A\n-B\n C\n+B\n A\n B\n-B\n A\n+C\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := mustLines(t, SplitLines(tt.a), SplitLines(tt.b))
+			assert.Equal(t, render(lines), tt.want)
+		})
+	}
+}
+
+func TestLinesLarge(t *testing.T) {
+	// Two large texts which differ in a handful of places can still be diffed quickly.
+	a := make([]string, 50000)
+	for i := range a {
+		a[i] = fmt.Sprintf("line %d", i)
+	}
+	b := slices.Clone(a)
+	b[10] = "changed"
+	b[25000] = "changed"
+	b = append(b, "added")
+
+	lines := mustLines(t, a, b)
+	assert.Equal(t, len(lines), 50000+3)
+	assert.Equal(t, len(Unified(lines, 3)), 3)
+
+	// But two large texts with nothing in common would need far too many edits.
+	c := make([]string, 50000)
+	for i := range c {
+		c[i] = fmt.Sprintf("other %d", i)
+	}
+	_, err := Lines(a, c)
+	assert.Equal(t, err, ErrTooDifferent)
+
+	// The limit is on the number of edits, not the size of the texts.
+	_, err = Lines(a[:MaxEdits/2], c[:MaxEdits/2])
+	assert.Equal(t, err, nil)
+	_, err = Lines(a[:MaxEdits/2+1], c[:MaxEdits/2])
+	assert.Equal(t, err, ErrTooDifferent)
+}
+
+func TestUnified(t *testing.T) {
+	a := SplitLines("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	b := SplitLines("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n")
+
+	hunks := Unified(mustLines(t, a, b), 2)
+	assert.Equal(t, len(hunks), 2)
+
+	assert.Equal(t, hunks[0].Header(), "@@ -1,5 +1,5 @@")
+	assert.Equal(t, render(hunks[0].Lines), " 1\n 2\n-3\n+three\n 4\n 5\n")
+
+	assert.Equal(t, hunks[1].Header(), "@@ -11,2 +11,3 @@")
+	assert.Equal(t, render(hunks[1].Lines), " 11\n 12\n+13\n")
+
+	// With more context the changes are close enough to be merged into one hunk.
+	hunks = Unified(mustLines(t, a, b), 5)
+	assert.Equal(t, len(hunks), 1)
+	assert.Equal(t, hunks[0].Header(), "@@ -1,12 +1,13 @@")
+
+	// An insertion into an empty text starts at line 0 on the old side.
+	hunks = Unified(mustLines(t, nil, []string{"a"}), 3)
+	assert.Equal(t, hunks[0].Header(), "@@ -0,0 +1,1 @@")
+}
+
+func TestSideBySide(t *testing.T) {
+	rows := SideBySide(mustLines(t, SplitLines("a\nb\nc\nd"), SplitLines("a\nx\ny\nd")))
+
+	assert.Equal(t, len(rows), 4)
+	assert.Equal(t, rows[0].Old.Text, "a")
+	assert.Equal(t, rows[0].New.Text, "a")
+	assert.Equal(t, rows[1].Old.Text, "b")
+	assert.Equal(t, rows[1].New.Text, "x")
+	assert.Equal(t, rows[2].Old.Text, "c")
+	assert.Equal(t, rows[2].New.Text, "y")
+	assert.Equal(t, rows[3].New.NewNumber, 4)
+}
@@ -0,0 +1,152 @@
+// Package highlight renders the content of snippet files as syntax-highlighted HTML, using chroma.
+//
+// The HTML uses CSS classes rather than inline styles, because the Content-Security-Policy header set by the application
+// doesn't allow inline styles. The matching stylesheet is ui/static/css/highlight.css, which can be regenerated with
+// WriteCSS() if the style is changed.
+package highlight
+
+import (
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// A Language is one of the languages which can be chosen for a file. Name is the name of the chroma lexer.
+type Language struct {
+	Name  string
+	Label string
+}
+
+// Languages lists the languages which can be chosen for a file, with the empty name meaning that the language is detected automatically.
+var Languages = []Language{
+	{Name: "", Label: "Auto-detect"},
+	{Name: "plaintext", Label: "Plain text"},
+	{Name: "bash", Label: "Shell"},
+	{Name: "c", Label: "C"},
+	{Name: "cpp", Label: "C++"},
+	{Name: "css", Label: "CSS"},
+	{Name: "docker", Label: "Dockerfile"},
+	{Name: "go", Label: "Go"},
+	{Name: "html", Label: "HTML"},
+	{Name: "ini", Label: "INI"},
+	{Name: "java", Label: "Java"},
+	{Name: "javascript", Label: "JavaScript"},
+	{Name: "json", Label: "JSON"},
+	{Name: "makefile", Label: "Makefile"},
+	{Name: "markdown", Label: "Markdown"},
+	{Name: "php", Label: "PHP"},
+	{Name: "python", Label: "Python"},
+	{Name: "ruby", Label: "Ruby"},
+	{Name: "rust", Label: "Rust"},
+	{Name: "sql", Label: "SQL"},
+	{Name: "toml", Label: "TOML"},
+	{Name: "typescript", Label: "TypeScript"},
+	{Name: "yaml", Label: "YAML"},
+}
+
+// ValidLanguage returns true if name is the name of one of the Languages.
+func ValidLanguage(name string) bool {
+	for _, language := range Languages {
+		if language.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+const styleName = "github"
+
+var formatter = html.New(html.WithClasses(true))
+
+// lexer() picks the lexer for a file: the one for its language if it has one, otherwise one which matches its filename,
+// otherwise one which recognises its content, and if all else fails, plain text.
+func lexer(filename, language, content string) chroma.Lexer {
+	l := lexers.Get(language)
+	if l == nil && filename != "" {
+		l = lexers.Match(filename)
+	}
+	if l == nil {
+		l = lexers.Analyse(content)
+	}
+	if l == nil {
+		l = lexers.Fallback
+	}
+	return chroma.Coalesce(l)
+}
+
+// HTML returns the content of a file as syntax-highlighted HTML, wrapped in a <pre> element.
+// All of the content is escaped by chroma, so the result is safe to include in a page.
+func HTML(filename, language, content string) (template.HTML, error) {
+	iterator, err := lexer(filename, language, content).Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	err = formatter.Format(&b, styles.Get(styleName), iterator)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(b.String()), nil
+}
+
+// A Line is a single line of a file as syntax-highlighted HTML, without a surrounding <pre> element or its newline.
+// Number is the line's 1-based line number.
+type Line struct {
+	Number int
+	HTML   template.HTML
+}
+
+// The lineFormatter formats the tokens of a single line, leaving it to the caller to lay out the lines.
+var lineFormatter = html.New(html.WithClasses(true), html.PreventSurroundingPre(true))
+
+// Lines returns the content of a file as syntax-highlighted HTML, one line at a time, so that the lines can be numbered
+// and have things shown between them. The whole file is tokenised at once, so multi-line tokens (like block comments)
+// are still highlighted correctly. A single trailing newline doesn't start another line, so a file has as many lines as
+// models.File.LineCount() says it does.
+func Lines(filename, language, content string) ([]Line, error) {
+	content = strings.TrimSuffix(content, "\n")
+
+	iterator, err := lexer(filename, language, content).Tokenise(nil, content)
+	if err != nil {
+		return nil, err
+	}
+
+	style := styles.Get(styleName)
+	lines := []Line{}
+
+	for i, tokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+		// Each line ends with a newline token (or a token ending in a newline), which isn't wanted inside the line.
+		if n := len(tokens); n > 0 {
+			last := tokens[n-1].Clone()
+			last.Value = strings.TrimSuffix(last.Value, "\n")
+			tokens = append(tokens[:n-1:n-1], last)
+		}
+
+		var b strings.Builder
+		err = lineFormatter.Format(&b, style, chroma.Literator(tokens...))
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, Line{Number: i + 1, HTML: template.HTML(b.String())})
+	}
+
+	// Chroma drops blank lines at the end of the content, but they're still lines of the file.
+	for n := strings.Count(content, "\n") + 1; len(lines) < n; {
+		lines = append(lines, Line{Number: len(lines) + 1})
+	}
+
+	return lines, nil
+}
+
+// WriteCSS writes the stylesheet for the highlighted HTML.
+func WriteCSS(w io.Writer) error {
+	return formatter.WriteCSS(w, styles.Get(styleName))
+}
@@ -0,0 +1,87 @@
+package highlight
+
+import (
+	"html/template"
+	"testing"
+
+	"snippetbox.linze.me/internal/assert"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		content  string
+		want     []template.HTML
+	}{
+		{
+			name:     "Single line",
+			language: "go",
+			content:  "a := 1",
+			want:     []template.HTML{`<span class="nx">a</span> <span class="o">:=</span> <span class="mi">1</span>`},
+		},
+		{
+			name:     "Trailing newline",
+			language: "plaintext",
+			content:  "a\nb\n",
+			want:     []template.HTML{"a", "b"},
+		},
+		{
+			name:     "Windows line endings",
+			language: "plaintext",
+			content:  "a\r\n\r\nb\r\n",
+			want:     []template.HTML{"a", "", "b"},
+		},
+		{
+			name:     "Empty file",
+			language: "go",
+			content:  "",
+			want:     []template.HTML{""},
+		},
+		{
+			name:     "Blank lines at the end",
+			language: "plaintext",
+			content:  "a\n\n\n",
+			want:     []template.HTML{"a", "", ""},
+		},
+		{
+			name:     "Block comment",
+			language: "go",
+			content:  "/* one\ntwo\nthree */\nx",
+			want: []template.HTML{
+				`<span class="cm">/* one</span>`,
+				`<span class="cm">two</span>`,
+				`<span class="cm">three */</span>`,
+				`<span class="nx">x</span>`,
+			},
+		},
+		{
+			name:     "String with a blank line",
+			language: "python",
+			content:  "x = '''a\n\nb'''\n",
+			want: []template.HTML{
+				`<span class="n">x</span> <span class="o">=</span> <span class="s1">&#39;&#39;&#39;a</span>`,
+				``,
+				`<span class="s1">b&#39;&#39;&#39;</span>`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := Lines("", tt.language, tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The number of lines must match models.File.LineCount(), since line comments are attached to lines by number.
+			assert.Equal(t, len(lines), len(tt.want))
+			for i, line := range lines {
+				if i < len(tt.want) {
+					assert.Equal(t, line.Number, i+1)
+					assert.Equal(t, line.HTML, tt.want[i])
+				}
+			}
+		})
+	}
+}
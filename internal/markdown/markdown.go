@@ -0,0 +1,120 @@
+// Package markdown renders Markdown snippet files and comments as HTML, using goldmark.
+//
+// Fenced code blocks are syntax-highlighted with the highlight package, so they share its CSS classes and stylesheet.
+// Everything goldmark produces is then passed through an allow-list sanitizer, so that the result is safe to include in a
+// page even if the Markdown contains raw HTML. The sanitizer doesn't allow style attributes or scripts, which wouldn't
+// be allowed by the application's Content-Security-Policy anyway.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+	"snippetbox.linze.me/internal/highlight"
+)
+
+// The converter uses GitHub Flavored Markdown (tables, strikethrough, autolinks and task lists), with our own renderer for fenced code blocks.
+// Raw HTML in the Markdown is left out by goldmark, because we don't use its html.WithUnsafe() option.
+var converter = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&codeBlockRenderer{}, 100)),
+	),
+)
+
+// The policy starts from bluemonday's policy for user generated content, and additionally allows the class attributes
+// used by the highlighted code blocks.
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)).OnElements("pre", "code", "span")
+	return p
+}
+
+// Comments use a "lite" version of Markdown: emphasis, inline code, code blocks, links, lists and quotes are allowed, but anything
+// else (like headings, images and tables) is reduced to plain text by the commentPolicy. Line breaks are kept as they were typed
+// and URLs are linked automatically, since that's what people expect when writing a quick comment.
+var commentConverter = goldmark.New(
+	goldmark.WithExtensions(extension.Linkify, extension.Strikethrough),
+	goldmark.WithRendererOptions(
+		html.WithHardWraps(),
+		renderer.WithNodeRenderers(util.Prioritized(&codeBlockRenderer{}, 100)),
+	),
+)
+
+var commentPolicy = newCommentPolicy()
+
+func newCommentPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "em", "strong", "del", "code", "pre", "span", "ul", "ol", "li", "blockquote")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)).OnElements("pre", "code", "span")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowStandardURLs()
+	p.RequireNoFollowOnLinks(true)
+	return p
+}
+
+// HTML renders Markdown source as sanitized HTML.
+func HTML(source string) (template.HTML, error) {
+	var b bytes.Buffer
+	err := converter.Convert([]byte(source), &b)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(policy.SanitizeBytes(b.Bytes())), nil
+}
+
+// Comment renders the "lite" Markdown used in comments as sanitized HTML.
+func Comment(source string) (template.HTML, error) {
+	var b bytes.Buffer
+	err := commentConverter.Convert([]byte(source), &b)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(commentPolicy.SanitizeBytes(b.Bytes())), nil
+}
+
+// The codeBlockRenderer renders fenced code blocks with the highlight package, using the language given after the opening fence.
+type codeBlockRenderer struct{}
+
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r *codeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+
+	var code bytes.Buffer
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		code.Write(line.Value(source))
+	}
+
+	html, err := highlight.HTML("", string(n.Language(source)), code.String())
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	_, err = w.WriteString(string(html))
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	// The block's lines have already been rendered, so there's no need to visit its children.
+	return ast.WalkSkipChildren, nil
+}
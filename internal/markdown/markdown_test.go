@@ -0,0 +1,110 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	"snippetbox.linze.me/internal/assert"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		want      []string
+		wantNotIn []string
+	}{
+		{
+			name:   "Basic formatting",
+			source: "# Runbook\n\nRestart the *web* server.",
+			want:   []string{"<h1>Runbook</h1>", "<em>web</em>"},
+		},
+		{
+			name:   "Fenced code block",
+			source: "```go\nfunc main() {}\n```",
+			want:   []string{`<pre class="chroma">`, `<span class="kd">func</span>`},
+		},
+		{
+			name:      "Raw HTML",
+			source:    "<script>alert(1)</script>\n\n<p onclick=\"alert(1)\">Hi</p>",
+			wantNotIn: []string{"<script>", "onclick"},
+		},
+		{
+			name:      "JavaScript link",
+			source:    "[click me](javascript:alert(1))",
+			wantNotIn: []string{"javascript:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := HTML(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.want {
+				assert.StringContains(t, string(html), want)
+			}
+			for _, notWant := range tt.wantNotIn {
+				if strings.Contains(string(html), notWant) {
+					t.Errorf("got: %q; expected not to contain: %q", html, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestComment(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		want      []string
+		wantNotIn []string
+	}{
+		{
+			name:   "Inline formatting",
+			source: "Use **bold**, *italics* and `code`",
+			want:   []string{"<strong>bold</strong>", "<em>italics</em>", "<code>code</code>"},
+		},
+		{
+			name:   "Line breaks",
+			source: "First line\nSecond line",
+			want:   []string{"First line<br>"},
+		},
+		{
+			name:   "Automatic links",
+			source: "See https://example.com",
+			want:   []string{`<a href="https://example.com" rel="nofollow">https://example.com</a>`},
+		},
+		{
+			name:      "Headings and images",
+			source:    "# Big\n\n![alt](https://example.com/a.png)",
+			want:      []string{"Big"},
+			wantNotIn: []string{"<h1>", "<img"},
+		},
+		{
+			name:      "Raw HTML",
+			source:    `<a href="javascript:alert(1)">x</a><script>alert(1)</script>`,
+			wantNotIn: []string{"<script>", "javascript:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := Comment(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.want {
+				assert.StringContains(t, string(html), want)
+			}
+			for _, notWant := range tt.wantNotIn {
+				if strings.Contains(string(html), notWant) {
+					t.Errorf("got: %q; expected not to contain: %q", html, notWant)
+				}
+			}
+		})
+	}
+}
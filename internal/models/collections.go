@@ -0,0 +1,290 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Define a Collection type to hold a named, ordered set of snippets which a user wants to share as a single link.
+// Like snippets, collections are identified in URLs by a random slug, so that unlisted collections can't be found by guessing.
+// They're stored in the collections table, and the snippets they include in the collection_snippets table:
+//
+//	CREATE TABLE collections (
+//		id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		slug CHAR(12) NOT NULL,
+//		user_id INTEGER NOT NULL,
+//		title VARCHAR(100) NOT NULL,
+//		description TEXT NOT NULL,
+//		visibility ENUM('public', 'unlisted', 'private') NOT NULL DEFAULT 'public',
+//		created DATETIME NOT NULL
+//	);
+//	CREATE UNIQUE INDEX collections_uc_slug ON collections (slug);
+//	CREATE INDEX idx_collections_user_id ON collections (user_id);
+//
+//	CREATE TABLE collection_snippets (
+//		collection_id INTEGER NOT NULL,
+//		snippet_id INTEGER NOT NULL,
+//		position INTEGER NOT NULL,
+//		PRIMARY KEY (collection_id, snippet_id)
+//	);
+//	CREATE INDEX idx_collection_snippets_snippet_id ON collection_snippets (snippet_id);
+type Collection struct {
+	ID          int
+	Slug        string
+	UserID      int
+	Title       string
+	Description string
+	Visibility  string // one of the same visibility levels as snippets
+	Created     time.Time
+	Count       int // the number of live snippets in the collection
+}
+
+// Define a CollectionModel type which wraps a database connection pool.
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+type CollectionModelInterface interface {
+	Insert(c *Collection) error
+	Update(c *Collection) error
+	Delete(id int) error
+	GetBySlug(slug string) (*Collection, error)
+	ByUser(userID int) ([]*Collection, error)
+	Containing(userID, snippetID int) ([]int, error)
+	Snippets(collectionID int) ([]*Snippet, error)
+	AddSnippet(collectionID, snippetID int) error
+	RemoveSnippet(collectionID, snippetID int) error
+	MoveSnippet(collectionID, snippetID int, up bool) error
+}
+
+// The collectionColumns constant lists the columns needed to populate a Collection, in the order expected by scanCollection().
+const collectionColumns = `id, slug, user_id, title, description, visibility, created,
+	(SELECT COUNT(*) FROM collection_snippets cs INNER JOIN snippets s ON s.id = cs.snippet_id
+	WHERE cs.collection_id = collections.id AND ` + notExpired + `)`
+
+func scanCollection(row interface{ Scan(dest ...any) error }) (*Collection, error) {
+	c := &Collection{}
+	err := row.Scan(&c.ID, &c.Slug, &c.UserID, &c.Title, &c.Description, &c.Visibility, &c.Created, &c.Count)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// This will insert a new collection, with no snippets in it. When it has been inserted, its ID and newly generated Slug are set on c.
+func (m *CollectionModel) Insert(c *Collection) error {
+	statement := `INSERT INTO collections (slug, user_id, title, description, visibility, created)
+	VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	// As with snippets, if two random slugs collide we simply try again with a new one.
+	for attempt := 1; ; attempt++ {
+		slug, err := generateSlug()
+		if err != nil {
+			return err
+		}
+
+		result, err := m.DB.Exec(statement, slug, c.UserID, c.Title, c.Description, c.Visibility)
+		if err != nil {
+			var mySQLError *mysql.MySQLError
+			if errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "collections_uc_slug") && attempt < 3 {
+				continue
+			}
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		c.ID = int(id)
+		c.Slug = slug
+		return nil
+	}
+}
+
+// This will update the title, description and visibility of a collection.
+func (m *CollectionModel) Update(c *Collection) error {
+	statement := "UPDATE collections SET title = ?, description = ?, visibility = ? WHERE id = ?"
+
+	_, err := m.DB.Exec(statement, c.Title, c.Description, c.Visibility, c.ID)
+	return err
+}
+
+// This will delete a collection. The snippets in it aren't affected.
+func (m *CollectionModel) Delete(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM collection_snippets WHERE collection_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM collections WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// This will return a specific collection based on its slug.
+func (m *CollectionModel) GetBySlug(slug string) (*Collection, error) {
+	statement := `SELECT ` + collectionColumns + ` FROM collections WHERE slug = ?`
+
+	c, err := scanCollection(m.DB.QueryRow(statement, slug))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// This will return all of a user's collections, whatever their visibility, in alphabetical order.
+func (m *CollectionModel) ByUser(userID int) ([]*Collection, error) {
+	statement := `SELECT ` + collectionColumns + ` FROM collections WHERE user_id = ? ORDER BY title, id`
+
+	rows, err := m.DB.Query(statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+// This will return the IDs of the user's collections which include the snippet.
+func (m *CollectionModel) Containing(userID, snippetID int) ([]int, error) {
+	statement := `SELECT c.id FROM collections c
+	INNER JOIN collection_snippets cs ON cs.collection_id = c.id
+	WHERE c.user_id = ? AND cs.snippet_id = ?`
+
+	rows, err := m.DB.Query(statement, userID, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// This will return the live snippets in a collection, in the collection's order, with their files loaded so that they can be shown in full.
+// Snippets of every visibility are included, so it's up to the caller to only show the ones that the user is allowed to see.
+func (m *CollectionModel) Snippets(collectionID int) ([]*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+	INNER JOIN collection_snippets cs ON cs.snippet_id = snippets.id
+	WHERE cs.collection_id = ? AND ` + notExpired + `
+	ORDER BY cs.position`
+
+	snippets, err := (&SnippetModel{DB: m.DB}).querySnippets(statement, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range snippets {
+		err = loadFiles(m.DB, s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return snippets, nil
+}
+
+// This will add a snippet to the end of a collection. Adding a snippet which is already in the collection does nothing.
+func (m *CollectionModel) AddSnippet(collectionID, snippetID int) error {
+	statement := `INSERT INTO collection_snippets (collection_id, snippet_id, position)
+	SELECT ?, ?, COALESCE(MAX(position), 0) + 1 FROM collection_snippets WHERE collection_id = ?
+	ON DUPLICATE KEY UPDATE position = position`
+
+	_, err := m.DB.Exec(statement, collectionID, snippetID, collectionID)
+	return err
+}
+
+// This will remove a snippet from a collection. Removing a snippet which isn't in the collection does nothing.
+func (m *CollectionModel) RemoveSnippet(collectionID, snippetID int) error {
+	_, err := m.DB.Exec("DELETE FROM collection_snippets WHERE collection_id = ? AND snippet_id = ?", collectionID, snippetID)
+	return err
+}
+
+// This will move a snippet one place up (towards the start) or down a collection, by swapping its position with the snippet next to it.
+// Moving the first snippet up or the last snippet down does nothing. If the snippet isn't in the collection, it returns ErrNoRecord.
+func (m *CollectionModel) MoveSnippet(collectionID, snippetID int, up bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var position int
+	err = tx.QueryRow("SELECT position FROM collection_snippets WHERE collection_id = ? AND snippet_id = ? FOR UPDATE", collectionID, snippetID).Scan(&position)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	statement := `SELECT snippet_id, position FROM collection_snippets
+	WHERE collection_id = ? AND position > ? ORDER BY position LIMIT 1 FOR UPDATE`
+	if up {
+		statement = `SELECT snippet_id, position FROM collection_snippets
+		WHERE collection_id = ? AND position < ? ORDER BY position DESC LIMIT 1 FOR UPDATE`
+	}
+
+	var otherID, otherPosition int
+	err = tx.QueryRow(statement, collectionID, position).Scan(&otherID, &otherPosition)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE collection_snippets SET position = ? WHERE collection_id = ? AND snippet_id = ?", otherPosition, collectionID, snippetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE collection_snippets SET position = ? WHERE collection_id = ? AND snippet_id = ?", position, collectionID, otherID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Define a Comment type to hold a single comment on a snippet. Comments can be replies to other comments on the same snippet,
+// forming threads. They're stored in the comments table:
+//
+//	CREATE TABLE comments (
+//		id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		snippet_id INTEGER NOT NULL,
+//		parent_id INTEGER NULL,
+//		user_id INTEGER NOT NULL,
+//		content TEXT NOT NULL,
+//		created DATETIME NOT NULL,
+//		updated DATETIME NULL,
+//		deleted BOOLEAN NOT NULL DEFAULT FALSE
+//	);
+//	CREATE INDEX idx_comments_snippet_id ON comments (snippet_id);
+//
+// Comments can also be about a range of lines in one of the snippet's files, identified by the file's position in the snippet:
+//
+//	ALTER TABLE comments ADD COLUMN file_position INTEGER NULL, ADD COLUMN line_start INTEGER NULL, ADD COLUMN line_end INTEGER NULL;
+type Comment struct {
+	ID        int
+	SnippetID int
+	ParentID  int // the ID of the comment this one replies to, or 0 if it's a top-level comment
+	UserID    int
+	UserName  string // the name and username of the user who wrote the comment, only loaded by ForSnippet()
+	Username  string
+	File      int // the position of the file the comment is about, if it's a line comment
+	LineStart int // the first and last lines the comment is about, or 0 if it's about the whole snippet
+	LineEnd   int
+	Content   string
+	Created   time.Time
+	Updated   *time.Time // nil if the comment has never been edited
+	Deleted   bool       // deleted comments which have replies are kept, without their content, so that the thread still makes sense
+	Depth     int        // how deeply the comment is nested in its thread, starting at 0, only set by ForSnippet()
+}
+
+// Define a CommentModel type which wraps a database connection pool.
+type CommentModel struct {
+	DB *sql.DB
+}
+
+type CommentModelInterface interface {
+	Insert(c *Comment) error
+	Get(id int) (*Comment, error)
+	ForSnippet(snippetID int) ([]*Comment, error)
+	Update(id int, content string) error
+	Delete(id int) error
+}
+
+// IsLineComment() returns true if the comment is about a range of lines, rather than the whole snippet.
+func (c *Comment) IsLineComment() bool {
+	return c.LineStart > 0
+}
+
+// Anchor() returns the URL fragment which identifies the lines a line comment is about, like "L10-L20".
+func (c *Comment) Anchor() string {
+	if c.LineEnd == c.LineStart {
+		return LineAnchor(c.File, c.LineStart)
+	}
+	return LineAnchor(c.File, c.LineStart) + "-L" + strconv.Itoa(c.LineEnd)
+}
+
+// LineAnchor() returns the URL fragment which identifies a line of a snippet file, given the file's position.
+// Lines of the first file are simply "L1", "L2" and so on, so that links to single-file snippets are short.
+// Lines of the other files are prefixed with the file's 1-based number, like "F2-L1".
+func LineAnchor(file, line int) string {
+	if file == 0 {
+		return "L" + strconv.Itoa(line)
+	}
+	return "F" + strconv.Itoa(file+1) + "-L" + strconv.Itoa(line)
+}
+
+// This will insert a new comment, setting its ID. Its ParentID should be 0 for a top-level comment, and its LineStart and LineEnd
+// should be 0 unless it's a line comment.
+func (m *CommentModel) Insert(c *Comment) error {
+	statement := `INSERT INTO comments (snippet_id, parent_id, user_id, file_position, line_start, line_end, content, created)
+	VALUES(?, NULLIF(?, 0), ?, IF(? > 0, ?, NULL), NULLIF(?, 0), NULLIF(?, 0), ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(statement, c.SnippetID, c.ParentID, c.UserID, c.LineStart, c.File, c.LineStart, c.LineEnd, c.Content)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	c.ID = int(id)
+	return nil
+}
+
+// This will return a specific comment, so long as it hasn't been deleted.
+func (m *CommentModel) Get(id int) (*Comment, error) {
+	statement := `SELECT id, snippet_id, COALESCE(parent_id, 0), user_id, COALESCE(file_position, 0), COALESCE(line_start, 0), COALESCE(line_end, 0),
+	content, created, updated, deleted FROM comments
+	WHERE id = ? AND NOT deleted`
+
+	c := &Comment{}
+	err := m.DB.QueryRow(statement, id).Scan(&c.ID, &c.SnippetID, &c.ParentID, &c.UserID, &c.File, &c.LineStart, &c.LineEnd,
+		&c.Content, &c.Created, &c.Updated, &c.Deleted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// This will return all of the comments on a snippet in thread order: each comment is followed by its replies (oldest first),
+// and each comment's Depth is set to how deeply it's nested.
+func (m *CommentModel) ForSnippet(snippetID int) ([]*Comment, error) {
+	statement := `SELECT c.id, c.snippet_id, COALESCE(c.parent_id, 0), c.user_id, COALESCE(u.name, ''), COALESCE(u.username, ''),
+	COALESCE(c.file_position, 0), COALESCE(c.line_start, 0), COALESCE(c.line_end, 0), c.content, c.created, c.updated, c.deleted
+	FROM comments c
+	LEFT JOIN users u ON u.id = c.user_id
+	WHERE c.snippet_id = ?
+	ORDER BY c.id`
+
+	rows, err := m.DB.Query(statement, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+
+	for rows.Next() {
+		c := &Comment{}
+		err = rows.Scan(&c.ID, &c.SnippetID, &c.ParentID, &c.UserID, &c.UserName, &c.Username, &c.File, &c.LineStart, &c.LineEnd,
+			&c.Content, &c.Created, &c.Updated, &c.Deleted)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return Thread(comments), nil
+}
+
+// Thread() sorts comments into thread order, with each comment followed by its replies, and sets their Depth.
+// The comments should be oldest first. Replies to comments which aren't in the list are treated as top-level comments.
+func Thread(comments []*Comment) []*Comment {
+	exists := map[int]bool{}
+	for _, c := range comments {
+		exists[c.ID] = true
+	}
+
+	replies := map[int][]*Comment{}
+	for _, c := range comments {
+		parentID := c.ParentID
+		if !exists[parentID] {
+			parentID = 0
+		}
+		replies[parentID] = append(replies[parentID], c)
+	}
+
+	threaded := make([]*Comment, 0, len(comments))
+
+	var walk func(parentID, depth int)
+	walk = func(parentID, depth int) {
+		for _, c := range replies[parentID] {
+			c.Depth = depth
+			threaded = append(threaded, c)
+			walk(c.ID, depth+1)
+		}
+	}
+	walk(0, 0)
+
+	return threaded
+}
+
+// This will change the content of a comment, recording when it was edited.
+func (m *CommentModel) Update(id int, content string) error {
+	_, err := m.DB.Exec("UPDATE comments SET content = ?, updated = UTC_TIMESTAMP() WHERE id = ? AND NOT deleted", content, id)
+	return err
+}
+
+// This will delete a comment. If the comment has replies, it's kept with its content removed, so that the replies still have something to reply to.
+func (m *CommentModel) Delete(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasReplies bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT true FROM comments WHERE parent_id = ?)", id).Scan(&hasReplies)
+	if err != nil {
+		return err
+	}
+
+	if hasReplies {
+		_, err = tx.Exec("UPDATE comments SET content = '', deleted = TRUE WHERE id = ?", id)
+	} else {
+		_, err = tx.Exec("DELETE FROM comments WHERE id = ?", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
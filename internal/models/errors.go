@@ -8,4 +8,10 @@ var (
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	// Add a new ErrDuplicateEmail error. We'll use this later if a user tries to signup with an email address that's already in use.
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+	// Add a new ErrDuplicateUsername error, which is returned if a user tries to signup with a username that's already taken.
+	ErrDuplicateUsername = errors.New("models: duplicate username")
+	// Add a new ErrDuplicateSlug error, which is returned if a user tries to create an organization with a slug that's already taken.
+	ErrDuplicateSlug = errors.New("models: duplicate slug")
+	// Add a new ErrAccountDisabled error, which is returned if a user whose account has been disabled by an admin tries to login.
+	ErrAccountDisabled = errors.New("models: account disabled")
 )
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"database/sql"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Define a File type to hold a single named file in a snippet. Every snippet has at least one file, and the content of the
+// first file is also kept in the snippets.content column, so that code which only deals with a single content string keeps working.
+// The files are stored in the snippet_files table:
+//
+//	CREATE TABLE snippet_files (
+//		id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		snippet_id INTEGER NOT NULL,
+//		position INTEGER NOT NULL,
+//		name VARCHAR(100) NOT NULL,
+//		language VARCHAR(30) NOT NULL,
+//		content MEDIUMTEXT NOT NULL
+//	);
+//	CREATE UNIQUE INDEX snippet_files_uc_position ON snippet_files (snippet_id, position);
+//
+// Snippets which existed before files were introduced are given a single, unnamed file with:
+//
+//	INSERT INTO snippet_files (snippet_id, position, name, language, content)
+//	SELECT id, 0, '', '', content FROM snippets;
+type File struct {
+	Name     string // may be empty, in which case DisplayName() makes one up
+	Language string // the name of the language used for syntax highlighting, or empty to detect it automatically
+	Content  string
+}
+
+// DisplayName() returns the file's name, or a name based on its position in the snippet if it doesn't have one.
+// The position is 0-based, so the first unnamed file is called "file1.txt".
+func (f *File) DisplayName(position int) string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return "file" + strconv.Itoa(position+1) + ".txt"
+}
+
+// IsMarkdown() returns true if the file holds Markdown, which is shown rendered as HTML rather than as highlighted source.
+// That's the case if its language is "markdown", or if its language is detected automatically and its name ends in .md or .markdown.
+func (f *File) IsMarkdown() bool {
+	if f.Language != "" {
+		return f.Language == "markdown"
+	}
+	ext := strings.ToLower(path.Ext(f.Name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// LineCount() returns the number of lines in the file. A newline at the end of the file doesn't start another line,
+// but any other newlines do, so an empty file has one (empty) line.
+func (f *File) LineCount() int {
+	return strings.Count(strings.TrimSuffix(f.Content, "\n"), "\n") + 1
+}
+
+// ValidFileName() returns true if name can be used as the name of a file in a snippet.
+// File names can't contain slashes or be "." or "..", so that they are safe to use as the names of files in a zip archive.
+func ValidFileName(name string) bool {
+	return name != "." && name != ".." && !strings.ContainsAny(name, `/\`) && path.Clean(name) == name
+}
+
+// The queryer interface is satisfied by both *sql.DB and *sql.Tx, so that files can be loaded either inside or outside of a transaction.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// The loadFiles() function loads the files for a snippet, in order.
+// If the snippet has no files (because the snippet_files rows haven't been backfilled yet), it's given a single unnamed file with its content.
+func loadFiles(q queryer, s *Snippet) error {
+	rows, err := q.Query("SELECT name, language, content FROM snippet_files WHERE snippet_id = ? ORDER BY position", s.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.Files = []*File{}
+
+	for rows.Next() {
+		f := &File{}
+		err = rows.Scan(&f.Name, &f.Language, &f.Content)
+		if err != nil {
+			return err
+		}
+		s.Files = append(s.Files, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(s.Files) == 0 {
+		s.Files = []*File{{Content: s.Content}}
+	}
+
+	return nil
+}
+
+// The insertFiles() function records the files for a new snippet, as part of the transaction which inserts the snippet.
+func insertFiles(tx *sql.Tx, snippetID int, files []*File) error {
+	statement := `INSERT INTO snippet_files (snippet_id, position, name, language, content)
+	VALUES(?, ?, ?, ?, ?)`
+
+	for i, f := range files {
+		_, err := tx.Exec(statement, snippetID, i, f.Name, f.Language, f.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
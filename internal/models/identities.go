@@ -0,0 +1,50 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Users can log in with an account at an OpenID Connect identity provider, which is identified by the provider's issuer URL and the
+// account's subject identifier. Unlike email addresses, subject identifiers never change, so once a user has logged in with single sign-on
+// we remember which of our users they are in the user_identities table:
+//
+//	CREATE TABLE user_identities (
+//		issuer VARCHAR(255) NOT NULL,
+//		subject VARCHAR(255) NOT NULL,
+//		user_id INTEGER NOT NULL,
+//		created DATETIME NOT NULL,
+//		PRIMARY KEY (issuer, subject)
+//	);
+//	CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+//
+// Define an IdentityModel type which wraps a database connection pool.
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+type IdentityModelInterface interface {
+	UserID(issuer, subject string) (int, error)
+	Link(userID int, issuer, subject string) error
+}
+
+// This will return the ID of the user linked to an identity provider's account. If there isn't one, it returns ErrNoRecord.
+func (m *IdentityModel) UserID(issuer, subject string) (int, error) {
+	var id int
+	err := m.DB.QueryRow("SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// This will link an identity provider's account to a user, so that logging in with it logs in as them.
+func (m *IdentityModel) Link(userID int, issuer, subject string) error {
+	_, err := m.DB.Exec("INSERT INTO user_identities (issuer, subject, user_id, created) VALUES(?, ?, ?, UTC_TIMESTAMP())", issuer, subject, userID)
+	return err
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Define an Invite type to hold a single-use code which lets someone sign up when registration is by invitation only.
+// Invites can be for a particular email address, in which case the signup form is pre-filled with it and only that address can be used.
+// They're stored in the invites table:
+//
+//	CREATE TABLE invites (
+//		id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		code CHAR(22) NOT NULL,
+//		email VARCHAR(255) NOT NULL,
+//		created_by INTEGER NULL,
+//		created DATETIME NOT NULL,
+//		expires DATETIME NOT NULL,
+//		used_by VARCHAR(255) NULL,
+//		used DATETIME NULL
+//	);
+//	CREATE UNIQUE INDEX invites_uc_code ON invites (code);
+//	CREATE INDEX idx_invites_created_by ON invites (created_by);
+type Invite struct {
+	ID        int
+	Code      string
+	Email     string // the email address the invite is for, or "" if it can be used with any address
+	CreatedBy int    // the ID of the user who created the invite, or 0 if it was created with a management command
+	Created   time.Time
+	Expires   time.Time
+	UsedBy    string     // the email address of the account the invite was used to create
+	Used      *time.Time // nil if the invite hasn't been used yet
+}
+
+// Define an InviteModel type which wraps a database connection pool.
+type InviteModel struct {
+	DB *sql.DB
+}
+
+type InviteModelInterface interface {
+	Insert(i *Invite) error
+	GetByCode(code string) (*Invite, error)
+	Claim(id int, email string) error
+	Release(id int) error
+	ByCreator(userID int) ([]*Invite, error)
+	Delete(id, userID int) error
+}
+
+// Expired() returns true if the invite can no longer be used because it's too old.
+func (i *Invite) Expired() bool {
+	return !i.Expires.After(time.Now())
+}
+
+// InviteCodeRX matches a valid invite code: 22 characters of URL-safe base64, which is 16 random bytes.
+var InviteCodeRX = regexp.MustCompile(`^[A-Za-z0-9_-]{22}$`)
+
+// generateInviteCode() returns a new random invite code. Unlike snippet slugs, invite codes are what stop strangers from signing up,
+// so they're long enough that they can't be guessed.
+func generateInviteCode() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// This will insert a new invite, which expires at i.Expires. When it has been inserted, its ID, newly generated Code and Created time are set on i.
+func (m *InviteModel) Insert(i *Invite) error {
+	statement := `INSERT INTO invites (code, email, created_by, created, expires)
+	VALUES(?, ?, NULLIF(?, 0), UTC_TIMESTAMP(), ?)`
+
+	for attempt := 1; ; attempt++ {
+		code, err := generateInviteCode()
+		if err != nil {
+			return err
+		}
+
+		result, err := m.DB.Exec(statement, code, i.Email, i.CreatedBy, i.Expires.UTC())
+		if err != nil {
+			var mySQLError *mysql.MySQLError
+			if errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "invites_uc_code") && attempt < 3 {
+				continue
+			}
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		i.ID = int(id)
+		i.Code = code
+		i.Created = time.Now().UTC()
+		return nil
+	}
+}
+
+// The inviteColumns constant lists the columns needed to populate an Invite, in the order expected by scanInvite().
+const inviteColumns = `id, code, email, COALESCE(created_by, 0), created, expires, COALESCE(used_by, ''), used`
+
+func scanInvite(row interface{ Scan(dest ...any) error }) (*Invite, error) {
+	i := &Invite{}
+	err := row.Scan(&i.ID, &i.Code, &i.Email, &i.CreatedBy, &i.Created, &i.Expires, &i.UsedBy, &i.Used)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// This will return the invite with the given code, so long as it hasn't been used and hasn't expired.
+func (m *InviteModel) GetByCode(code string) (*Invite, error) {
+	statement := `SELECT ` + inviteColumns + ` FROM invites
+	WHERE code = ? AND used IS NULL AND expires > UTC_TIMESTAMP()`
+
+	i, err := scanInvite(m.DB.QueryRow(statement, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return i, nil
+}
+
+// This will mark an invite as used by the given email address. It's done in a single statement, so that if two people try to use
+// the same invite at once only one of them succeeds: if the invite has already been used (or has expired), it returns ErrNoRecord.
+func (m *InviteModel) Claim(id int, email string) error {
+	statement := `UPDATE invites SET used_by = ?, used = UTC_TIMESTAMP()
+	WHERE id = ? AND used IS NULL AND expires > UTC_TIMESTAMP()`
+
+	result, err := m.DB.Exec(statement, email, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will make a claimed invite usable again. It's for when the account the invite was claimed for couldn't be created after all,
+// for example because the username was already taken.
+func (m *InviteModel) Release(id int) error {
+	_, err := m.DB.Exec("UPDATE invites SET used_by = NULL, used = NULL WHERE id = ?", id)
+	return err
+}
+
+// This will return all of the invites a user has created, whether or not they've been used, most recent first.
+func (m *InviteModel) ByCreator(userID int) ([]*Invite, error) {
+	statement := `SELECT ` + inviteColumns + ` FROM invites WHERE created_by = ? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*Invite{}
+	for rows.Next() {
+		i, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// This will delete an unused invite created by the given user, so that it can't be used. Used invites are kept as a record of who invited whom.
+// If there's no such invite, it returns ErrNoRecord.
+func (m *InviteModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec("DELETE FROM invites WHERE id = ? AND created_by = ? AND used IS NULL", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
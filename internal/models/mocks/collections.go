@@ -0,0 +1,123 @@
+package mocks
+
+import (
+	"slices"
+	"time"
+
+	"snippetbox.linze.me/internal/models"
+)
+
+// mockCollection is Alice's public collection. It includes her private snippet, which only she can see,
+// and snippets which are protected by a password or encrypted, whose content can't be shown on the collection page.
+var mockCollection = &models.Collection{
+	ID:          1,
+	Slug:        "K8s-Debug1ng",
+	UserID:      1,
+	Title:       "k8s debugging",
+	Description: "Things to try when a pod won't start.",
+	Visibility:  models.VisibilityPublic,
+	Created:     time.Now(),
+}
+
+// mockPrivateCollection is Alice's private collection.
+var mockPrivateCollection = &models.Collection{
+	ID:         2,
+	Slug:       "Pr1vate-C0ll",
+	UserID:     1,
+	Title:      "Drafts",
+	Visibility: models.VisibilityPrivate,
+	Created:    time.Now(),
+}
+
+// mockBobCollection is Bob's unlisted collection, which is empty.
+var mockBobCollection = &models.Collection{
+	ID:         3,
+	Slug:       "B0bs-Favour1",
+	UserID:     2,
+	Title:      "Bob's favourites",
+	Visibility: models.VisibilityUnlisted,
+	Created:    time.Now(),
+}
+
+var mockCollections = []*models.Collection{mockCollection, mockPrivateCollection, mockBobCollection}
+
+// mockCollectionSnippets holds the snippets in each collection, by collection ID, in order.
+var mockCollectionSnippets = map[int][]*models.Snippet{
+	1: {mockSnippet, mockMultiFileSnippet, mockPrivateSnippet, mockProtectedSnippet, mockEncryptedSnippet},
+	2: {mockSnippet},
+}
+
+func init() {
+	for _, c := range mockCollections {
+		c.Count = len(mockCollectionSnippets[c.ID])
+	}
+}
+
+type CollectionModel struct{}
+
+func (m *CollectionModel) Insert(c *models.Collection) error {
+	c.ID = 4
+	c.Slug = "N3wC0llect-4"
+	return nil
+}
+
+func (m *CollectionModel) Update(c *models.Collection) error {
+	return nil
+}
+
+func (m *CollectionModel) Delete(id int) error {
+	return nil
+}
+
+func (m *CollectionModel) GetBySlug(slug string) (*models.Collection, error) {
+	for _, c := range mockCollections {
+		if c.Slug == slug {
+			collection := *c
+			return &collection, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *CollectionModel) ByUser(userID int) ([]*models.Collection, error) {
+	collections := []*models.Collection{}
+	for _, c := range mockCollections {
+		if c.UserID == userID {
+			collections = append(collections, c)
+		}
+	}
+	return collections, nil
+}
+
+func (m *CollectionModel) Containing(userID, snippetID int) ([]int, error) {
+	ids := []int{}
+	for _, c := range mockCollections {
+		if c.UserID == userID && slices.ContainsFunc(mockCollectionSnippets[c.ID], func(s *models.Snippet) bool { return s.ID == snippetID }) {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *CollectionModel) Snippets(collectionID int) ([]*models.Snippet, error) {
+	snippets := []*models.Snippet{}
+	for _, s := range mockCollectionSnippets[collectionID] {
+		snippets = append(snippets, clone(s))
+	}
+	return snippets, nil
+}
+
+func (m *CollectionModel) AddSnippet(collectionID, snippetID int) error {
+	return nil
+}
+
+func (m *CollectionModel) RemoveSnippet(collectionID, snippetID int) error {
+	return nil
+}
+
+func (m *CollectionModel) MoveSnippet(collectionID, snippetID int, up bool) error {
+	if !slices.ContainsFunc(mockCollectionSnippets[collectionID], func(s *models.Snippet) bool { return s.ID == snippetID }) {
+		return models.ErrNoRecord
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package mocks
+
+import (
+	"time"
+
+	"snippetbox.linze.me/internal/models"
+)
+
+// mockComments holds a short thread on mockSnippet, oldest first: a comment by Alice, a reply by Bob, and a separate comment by Bob.
+// There's also a line comment by Bob on the two lines of run.sh, the third file of mockMultiFileSnippet.
+var mockComments = []*models.Comment{
+	{
+		ID:        1,
+		SnippetID: 1,
+		UserID:    1,
+		UserName:  "Alice",
+		Username:  "alice",
+		Content:   "Should this be **five** syllables?",
+		Created:   time.Now().Add(-2 * time.Hour),
+	},
+	{
+		ID:        3,
+		SnippetID: 1,
+		UserID:    2,
+		UserName:  "Bob",
+		Username:  "bob",
+		Content:   "I like the `frog`.",
+		Created:   time.Now().Add(-90 * time.Minute),
+	},
+	{
+		ID:        2,
+		SnippetID: 1,
+		ParentID:  1,
+		UserID:    2,
+		UserName:  "Bob",
+		Username:  "bob",
+		Content:   "It's fine as it is.",
+		Created:   time.Now().Add(-time.Hour),
+	},
+	{
+		ID:        5,
+		SnippetID: 8,
+		UserID:    2,
+		UserName:  "Bob",
+		Username:  "bob",
+		File:      2,
+		LineStart: 1,
+		LineEnd:   2,
+		Content:   "Should this `exec` be quoted?",
+		Created:   time.Now().Add(-time.Hour),
+	},
+}
+
+type CommentModel struct{}
+
+func (m *CommentModel) Insert(c *models.Comment) error {
+	c.ID = 4
+	return nil
+}
+
+func (m *CommentModel) Get(id int) (*models.Comment, error) {
+	for _, c := range mockComments {
+		if c.ID == id {
+			comment := *c
+			return &comment, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *CommentModel) ForSnippet(snippetID int) ([]*models.Comment, error) {
+	comments := []*models.Comment{}
+	for _, c := range mockComments {
+		if c.SnippetID == snippetID {
+			comment := *c
+			comments = append(comments, &comment)
+		}
+	}
+	return models.Thread(comments), nil
+}
+
+func (m *CommentModel) Update(id int, content string) error {
+	return nil
+}
+
+func (m *CommentModel) Delete(id int) error {
+	return nil
+}
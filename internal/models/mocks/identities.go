@@ -0,0 +1,19 @@
+package mocks
+
+import (
+	"snippetbox.linze.me/internal/models"
+)
+
+type IdentityModel struct{}
+
+// Alice has already logged in with single sign-on, with the subject identifier "alice-sub".
+func (m *IdentityModel) UserID(issuer, subject string) (int, error) {
+	if subject == "alice-sub" {
+		return 1, nil
+	}
+	return 0, models.ErrNoRecord
+}
+
+func (m *IdentityModel) Link(userID int, issuer, subject string) error {
+	return nil
+}
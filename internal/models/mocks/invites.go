@@ -0,0 +1,94 @@
+package mocks
+
+import (
+	"time"
+
+	"snippetbox.linze.me/internal/models"
+)
+
+// mockInvite was created by Bob, and can be used with any email address.
+var mockInvite = &models.Invite{
+	ID:        1,
+	Code:      "0pen-Inv1te-Code-12345",
+	CreatedBy: 2,
+	Created:   time.Now(),
+	Expires:   time.Now().Add(7 * 24 * time.Hour),
+}
+
+// mockEmailInvite was created by Alice for carol@example.com.
+var mockEmailInvite = &models.Invite{
+	ID:        2,
+	Code:      "Ema1l-Inv1te-Code-1234",
+	Email:     "carol@example.com",
+	CreatedBy: 1,
+	Created:   time.Now(),
+	Expires:   time.Now().Add(7 * 24 * time.Hour),
+}
+
+// mockUsedInvite was created by Bob, and has already been used.
+var mockUsedInvite = &models.Invite{
+	ID:        3,
+	Code:      "Used-Inv1te-Code-12345",
+	CreatedBy: 2,
+	Created:   time.Now().Add(-48 * time.Hour),
+	Expires:   time.Now().Add(5 * 24 * time.Hour),
+	UsedBy:    "dave@example.com",
+	Used:      timePtr(time.Now().Add(-24 * time.Hour)),
+}
+
+var mockInvites = []*models.Invite{mockUsedInvite, mockEmailInvite, mockInvite}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+type InviteModel struct{}
+
+func (m *InviteModel) Insert(i *models.Invite) error {
+	i.ID = 4
+	i.Code = "N3w-Inv1te-Code-123456"
+	i.Created = time.Now()
+	return nil
+}
+
+func (m *InviteModel) GetByCode(code string) (*models.Invite, error) {
+	for _, i := range mockInvites {
+		if i.Code == code && i.Used == nil {
+			invite := *i
+			return &invite, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *InviteModel) Claim(id int, email string) error {
+	for _, i := range mockInvites {
+		if i.ID == id && i.Used == nil {
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *InviteModel) Release(id int) error {
+	return nil
+}
+
+func (m *InviteModel) ByCreator(userID int) ([]*models.Invite, error) {
+	invites := []*models.Invite{}
+	for _, i := range mockInvites {
+		if i.CreatedBy == userID {
+			invites = append(invites, i)
+		}
+	}
+	return invites, nil
+}
+
+func (m *InviteModel) Delete(id, userID int) error {
+	for _, i := range mockInvites {
+		if i.ID == id && i.CreatedBy == userID && i.Used == nil {
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
@@ -0,0 +1,112 @@
+package mocks
+
+import (
+	"slices"
+	"time"
+
+	"snippetbox.linze.me/internal/models"
+)
+
+// mockOrg is owned by Alice, and Bob is a member of it.
+var mockOrg = &models.Org{
+	ID:      1,
+	Slug:    "acme",
+	Name:    "Acme Corp",
+	Created: time.Now(),
+}
+
+// mockBobco is owned by Bob, and Alice isn't a member of it.
+var mockBobco = &models.Org{
+	ID:      2,
+	Slug:    "bobco",
+	Name:    "Bobco",
+	Created: time.Now(),
+}
+
+var mockOrgs = []*models.Org{mockOrg, mockBobco}
+
+// mockMembers holds the members of each organization, by organization ID.
+var mockMembers = map[int][]*models.Member{
+	1: {
+		{UserID: 1, Name: "Alice", Username: "alice", Role: models.OrgRoleOwner, Created: time.Now()},
+		{UserID: 2, Name: "Bob", Username: "bob", Role: models.OrgRoleMember, Created: time.Now()},
+	},
+	2: {
+		{UserID: 2, Name: "Bob", Username: "bob", Role: models.OrgRoleOwner, Created: time.Now()},
+	},
+}
+
+// The isMember() function returns true if the user is a member of the organization.
+func isMember(orgID, userID int) bool {
+	return slices.ContainsFunc(mockMembers[orgID], func(m *models.Member) bool { return m.UserID == userID })
+}
+
+type OrgModel struct{}
+
+func (m *OrgModel) Insert(o *models.Org, ownerID int) error {
+	for _, org := range mockOrgs {
+		if org.Slug == o.Slug {
+			return models.ErrDuplicateSlug
+		}
+	}
+	o.ID = 3
+	return nil
+}
+
+func (m *OrgModel) Get(id int) (*models.Org, error) {
+	for _, o := range mockOrgs {
+		if o.ID == id {
+			org := *o
+			return &org, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *OrgModel) GetBySlug(slug string) (*models.Org, error) {
+	for _, o := range mockOrgs {
+		if o.Slug == slug {
+			org := *o
+			return &org, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *OrgModel) ForUser(userID int) ([]*models.Org, error) {
+	orgs := []*models.Org{}
+	for _, o := range mockOrgs {
+		for _, member := range mockMembers[o.ID] {
+			if member.UserID == userID {
+				org := *o
+				org.Role = member.Role
+				orgs = append(orgs, &org)
+			}
+		}
+	}
+	return orgs, nil
+}
+
+func (m *OrgModel) Roles(userID int) (map[int]string, error) {
+	roles := map[int]string{}
+	for orgID, members := range mockMembers {
+		for _, member := range members {
+			if member.UserID == userID {
+				roles[orgID] = member.Role
+			}
+		}
+	}
+	return roles, nil
+}
+
+func (m *OrgModel) Members(orgID int) ([]*models.Member, error) {
+	return mockMembers[orgID], nil
+}
+
+func (m *OrgModel) SetMember(orgID, userID int, role string) error {
+	return nil
+}
+
+func (m *OrgModel) RemoveMember(orgID, userID int) error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package mocks
+
+import (
+	"time"
+
+	"snippetbox.linze.me/internal/models"
+)
+
+var mockSession = &models.Session{
+	ID:        1,
+	Token:     "mock-session-token",
+	UserID:    1,
+	Created:   time.Now(),
+	LastSeen:  time.Now(),
+	IP:        "192.0.2.1",
+	UserAgent: "Mozilla/5.0 (Mock Browser)",
+}
+
+type SessionModel struct{}
+
+func (m *SessionModel) Insert(token string, userID int, ip, userAgent string) error {
+	return nil
+}
+
+func (m *SessionModel) Touch(token string) error {
+	return nil
+}
+
+func (m *SessionModel) Get(id, userID int) (*models.Session, error) {
+	if id == 1 && userID == 1 {
+		return mockSession, nil
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *SessionModel) ForUser(userID int) ([]*models.Session, error) {
+	if userID == 1 {
+		return []*models.Session{mockSession}, nil
+	}
+	return []*models.Session{}, nil
+}
+
+func (m *SessionModel) Delete(token string) error {
+	return nil
+}
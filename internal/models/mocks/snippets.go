@@ -1,34 +1,487 @@
 package mocks
 
 import (
+	"slices"
+	"strings"
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"snippetbox.linze.me/internal/models"
 )
 
 var mockSnippet = &models.Snippet{
-	ID: 1,
-	Title: "An old silent pond",
-	Content: "An old silent pond...",
+	ID:         1,
+	Slug:       "b6dL_k3fQz1x",
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Created:    time.Now(),
+	Expires:    expiresIn(24 * time.Hour),
+	UserID:     1,
+	Visibility: models.VisibilityPublic,
+	Tags:       []string{"haiku", "poetry"},
+	Stars:      2,
+}
+
+var mockPrivateSnippet = &models.Snippet{
+	ID:      3,
+	Slug:    "Wnt3r-F0rest",
+	Title:   "Over the wintry forest",
+	Content: "Over the wintry forest, winds howl in rage...",
 	Created: time.Now(),
-	Expires: time.Now(),
+	// This snippet never expires.
+	Expires:    nil,
+	UserID:     1,
+	Visibility: models.VisibilityPrivate,
+}
+
+var mockBurnSnippet = &models.Snippet{
+	ID:               4,
+	Slug:             "Burn-Aft3r-R",
+	Title:            "Database password",
+	Content:          "correct horse battery staple",
+	Created:          time.Now(),
+	Expires:          expiresIn(24 * time.Hour),
+	UserID:           1,
+	Visibility:       models.VisibilityUnlisted,
+	BurnAfterReading: true,
+}
+
+// The password for mockProtectedSnippet is "hunter22". We use the minimum bcrypt cost to keep the tests fast.
+var mockProtectedSnippet = &models.Snippet{
+	ID:             5,
+	Slug:           "Pr0tected-55",
+	Title:          "Staging server",
+	Content:        "ssh deploy@staging.example.com",
+	Created:        time.Now(),
+	Expires:        expiresIn(24 * time.Hour),
+	UserID:         2,
+	Visibility:     models.VisibilityUnlisted,
+	HashedPassword: mustHashPassword("hunter22"),
+}
+
+// The content of mockEncryptedSnippet is opaque ciphertext, in the same format as produced by ui/static/js/crypto.js.
+var mockEncryptedSnippet = &models.Snippet{
+	ID:         6,
+	Slug:       "Encrypt3d-66",
+	Title:      "Encrypted notes",
+	Content:    "q9Wl2yV0c1xg3H7k.mH3s1cXv0yqkz9Yf2v8t0QnB1aL4wE5r",
+	Created:    time.Now(),
+	Expires:    expiresIn(24 * time.Hour),
+	UserID:     1,
+	Visibility: models.VisibilityUnlisted,
+	Encrypted:  true,
+}
+
+// mockForkSnippet is a public fork of mockSnippet.
+var mockForkSnippet = &models.Snippet{
+	ID:         7,
+	Slug:       "F0rked-Snip7",
+	Title:      "A frog jumps in",
+	Content:    "An old silent pond...\nA frog jumps into the pond",
+	Created:    time.Now(),
+	Expires:    expiresIn(24 * time.Hour),
+	UserID:     2,
+	Visibility: models.VisibilityPublic,
+	ParentID:   1,
+	Tags:       []string{"haiku"},
+	Stars:      1,
+}
+
+// mockMultiFileSnippet has several files, including one without a language.
+var mockMultiFileSnippet = &models.Snippet{
+	ID:         8,
+	Slug:       "Mult1-F1les8",
+	Title:      "Deployment",
+	Content:    "FROM golang:1.21\nCOPY . /app",
+	Created:    time.Now(),
+	Expires:    expiresIn(24 * time.Hour),
+	UserID:     1,
+	OrgID:      1,
+	Visibility: models.VisibilityPublic,
+	Files: []*models.File{
+		{Name: "Dockerfile", Language: "docker", Content: "FROM golang:1.21\nCOPY . /app"},
+		{Name: "config.yaml", Language: "yaml", Content: "addr: :4000"},
+		{Name: "run.sh", Content: "#!/bin/sh\nexec ./web"},
+	},
+}
+
+// mockMarkdownSnippet has a single Markdown file, which tries to sneak in a script.
+var mockMarkdownSnippet = &models.Snippet{
+	ID:         9,
+	Slug:       "Markd0wn-N09",
+	Title:      "Restarting the server",
+	Content:    "# Restarting\n\n<script>alert(1)</script>\n\n```sh\nsystemctl restart web\n```",
+	Created:    time.Now(),
+	Expires:    expiresIn(24 * time.Hour),
+	UserID:     1,
+	Visibility: models.VisibilityUnlisted,
+	Files: []*models.File{
+		{Name: "runbook.md", Content: "# Restarting\n\n<script>alert(1)</script>\n\n```sh\nsystemctl restart web\n```"},
+	},
+}
+
+// mockOrgSnippet was created by Alice for the Acme organization, and is only visible to its members (Alice and Bob).
+var mockOrgSnippet = &models.Snippet{
+	ID:         11,
+	Slug:       "0rg-Sn1ppet1",
+	Title:      "Team runbook",
+	Content:    "kubectl rollout restart deploy/web",
+	Created:    time.Now(),
+	Expires:    expiresIn(24 * time.Hour),
+	UserID:     1,
+	OrgID:      1,
+	Visibility: models.VisibilityOrg,
 }
 
-type SnippetModel struct{}
+// mockBobcoSnippet was created by Bob for the Bobco organization, which Alice isn't a member of.
+var mockBobcoSnippet = &models.Snippet{
+	ID:         12,
+	Slug:       "B0bc0-Sn1p12",
+	Title:      "Bobco roadmap",
+	Content:    "World domination",
+	Created:    time.Now(),
+	Expires:    expiresIn(24 * time.Hour),
+	UserID:     2,
+	OrgID:      2,
+	Visibility: models.VisibilityOrg,
+}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	return 2, nil
+// mockLeftOrgSnippet was created by Alice for the Bobco organization, which she has since left, so she can't see it any more.
+var mockLeftOrgSnippet = &models.Snippet{
+	ID:         13,
+	Slug:       "L3ft-0rgSn13",
+	Title:      "Old Bobco notes",
+	Content:    "Things I learned at Bobco",
+	Created:    time.Now(),
+	Expires:    expiresIn(24 * time.Hour),
+	UserID:     1,
+	OrgID:      2,
+	Visibility: models.VisibilityOrg,
+}
+
+// mockNumericSlugSnippet has a slug which strconv.Atoi() accepts as a (negative) number, even though it isn't all digits.
+// It's only ever returned by GetBySlug().
+var mockNumericSlugSnippet = &models.Snippet{
+	ID:         14,
+	Slug:       "-12345678901",
+	Title:      "Negative numbers",
+	Content:    "Below zero",
+	Created:    time.Now(),
+	Expires:    expiresIn(24 * time.Hour),
+	UserID:     2,
+	Visibility: models.VisibilityPublic,
+}
+
+// mockExpiredSnippet has expired, so it's only ever returned by AllByUser().
+var mockExpiredSnippet = &models.Snippet{
+	ID:         10,
+	Slug:       "Exp1red-Sn10",
+	Title:      "Yesterday's news",
+	Content:    "Nothing to see here",
+	Created:    time.Now().Add(-48 * time.Hour),
+	Expires:    expiresIn(-24 * time.Hour),
+	UserID:     1,
+	Visibility: models.VisibilityPublic,
+}
+
+// mockRevisions holds the history of mockSnippet, newest first.
+var mockRevisions = []*models.Revision{
+	{
+		ID:        12,
+		SnippetID: 1,
+		Number:    2,
+		UserID:    1,
+		UserName:  "Alice",
+		Title:     "An old silent pond",
+		Content:   "An old silent pond...",
+		Files:     []*models.File{{Content: "An old silent pond..."}},
+		Created:   time.Now(),
+	},
+	{
+		ID:        11,
+		SnippetID: 1,
+		Number:    1,
+		UserID:    1,
+		UserName:  "Alice",
+		Title:     "An old pond",
+		Content:   "An old pond...",
+		Files:     []*models.File{{Content: "An old pond..."}},
+		Created:   time.Now().Add(-time.Hour),
+	},
+}
+
+// mockMultiFileRevisions holds the history of mockMultiFileSnippet, newest first. Between the two revisions the Dockerfile was changed,
+// notes.txt was removed, and config.yaml and run.sh were added.
+var mockMultiFileRevisions = []*models.Revision{
+	{
+		ID:        16,
+		SnippetID: 8,
+		Number:    2,
+		UserID:    1,
+		UserName:  "Alice",
+		Title:     "Deployment",
+		Content:   "FROM golang:1.21\nCOPY . /app",
+		Files:     mockMultiFileSnippet.Files,
+		Created:   time.Now(),
+	},
+	{
+		ID:        15,
+		SnippetID: 8,
+		Number:    1,
+		UserID:    1,
+		UserName:  "Alice",
+		Title:     "Deployment",
+		Content:   "FROM golang:1.20\nCOPY . /app",
+		Files: []*models.File{
+			{Name: "Dockerfile", Language: "docker", Content: "FROM golang:1.20\nCOPY . /app"},
+			{Name: "notes.txt", Content: "Remember to add a config file"},
+		},
+		Created: time.Now().Add(-time.Hour),
+	},
+}
+
+// The clone() function returns a copy of a mock snippet, so that handlers which modify the snippet they're given (like snippetEditPost)
+// don't affect the other tests.
+func clone(s *models.Snippet) *models.Snippet {
+	c := *s
+
+	// Like the real model, give snippets without any files a single unnamed file with their content.
+	if len(c.Files) == 0 {
+		c.Files = []*models.File{{Content: c.Content}}
+	}
+
+	return &c
+}
+
+func expiresIn(d time.Duration) *time.Time {
+	t := time.Now().Add(d)
+	return &t
+}
+
+func mustHashPassword(password string) []byte {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		panic(err)
+	}
+	return hashedPassword
+}
+
+type SnippetModel struct {
+	// inserted holds the snippets created with Insert(), so that they can show up on the home page like they would with the real model.
+	inserted []*models.Snippet
+}
+
+func (m *SnippetModel) Insert(s *models.Snippet, password string) error {
+	s.ID = 2
+	s.Slug = "N3wSn1ppet-2"
+	m.inserted = append(m.inserted, s)
+	return nil
+}
+
+func (m *SnippetModel) Update(s *models.Snippet, userID int) error {
+	return nil
+}
+
+func (m *SnippetModel) Revisions(snippetID int) ([]*models.Revision, error) {
+	switch snippetID {
+	case mockSnippet.ID:
+		return mockRevisions, nil
+	case mockMultiFileSnippet.ID:
+		return mockMultiFileRevisions, nil
+	default:
+		return []*models.Revision{}, nil
+	}
 }
 
 func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockPrivateSnippet, nil
+	case 4:
+		return clone(mockBurnSnippet), nil
+	case 5:
+		return mockProtectedSnippet, nil
+	case 6:
+		return mockEncryptedSnippet, nil
+	case 7:
+		return mockForkSnippet, nil
+	case 8:
+		return mockMultiFileSnippet, nil
+	case 9:
+		return mockMarkdownSnippet, nil
+	case 11:
+		return mockOrgSnippet, nil
+	case 12:
+		return mockBobcoSnippet, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) GetBySlug(slug string) (*models.Snippet, error) {
+	switch slug {
+	case mockSnippet.Slug:
+		return clone(mockSnippet), nil
+	case mockPrivateSnippet.Slug:
+		return clone(mockPrivateSnippet), nil
+	case mockBurnSnippet.Slug:
+		return clone(mockBurnSnippet), nil
+	case mockProtectedSnippet.Slug:
+		return clone(mockProtectedSnippet), nil
+	case mockEncryptedSnippet.Slug:
+		return clone(mockEncryptedSnippet), nil
+	case mockForkSnippet.Slug:
+		return clone(mockForkSnippet), nil
+	case mockMultiFileSnippet.Slug:
+		return clone(mockMultiFileSnippet), nil
+	case mockMarkdownSnippet.Slug:
+		return clone(mockMarkdownSnippet), nil
+	case mockOrgSnippet.Slug:
+		return clone(mockOrgSnippet), nil
+	case mockBobcoSnippet.Slug:
+		return clone(mockBobcoSnippet), nil
+	case mockLeftOrgSnippet.Slug:
+		return clone(mockLeftOrgSnippet), nil
+	case mockNumericSlugSnippet.Slug:
+		return clone(mockNumericSlugSnippet), nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
 
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
-	return []*models.Snippet{mockSnippet}, nil
-}
\ No newline at end of file
+	latest := []*models.Snippet{}
+	for _, s := range append(slices.Clone(m.inserted), mockSnippet) {
+		if s.Visibility == models.VisibilityPublic {
+			latest = append(latest, s)
+		}
+	}
+	return latest, nil
+}
+
+func (m *SnippetModel) Forks(parentID int) ([]*models.Snippet, error) {
+	if parentID == mockForkSnippet.ParentID {
+		return []*models.Snippet{mockForkSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+// mockPublicSnippets holds the live, public snippets, most recent first, for the methods which list them.
+var mockPublicSnippets = []*models.Snippet{mockMultiFileSnippet, mockForkSnippet, mockSnippet}
+
+// mockSnippets holds all of the mock snippets, most recent first.
+var mockSnippets = []*models.Snippet{mockLeftOrgSnippet, mockBobcoSnippet, mockOrgSnippet, mockMarkdownSnippet, mockMultiFileSnippet, mockForkSnippet, mockEncryptedSnippet, mockProtectedSnippet, mockBurnSnippet, mockPrivateSnippet, mockSnippet, mockExpiredSnippet}
+
+// The page() function returns a page of the snippets which match a condition, along with the total number of them, like the real model's paginated methods.
+func page(snippets []*models.Snippet, match func(*models.Snippet) bool, limit, offset int) ([]*models.Snippet, int, error) {
+	matched := []*models.Snippet{}
+	for _, s := range snippets {
+		if match(s) {
+			matched = append(matched, s)
+		}
+	}
+
+	total := len(matched)
+	return matched[min(offset, total):min(offset+limit, total)], total, nil
+}
+
+func (m *SnippetModel) Tagged(tag string, limit, offset int) ([]*models.Snippet, int, error) {
+	return page(mockPublicSnippets, func(s *models.Snippet) bool { return slices.Contains(s.Tags, tag) }, limit, offset)
+}
+
+func (m *SnippetModel) ByUser(userID, limit, offset int) ([]*models.Snippet, int, error) {
+	return page(mockPublicSnippets, func(s *models.Snippet) bool { return s.UserID == userID }, limit, offset)
+}
+
+func (m *SnippetModel) AllByUser(userID, limit, offset int) ([]*models.Snippet, int, error) {
+	return page(mockSnippets, func(s *models.Snippet) bool {
+		return s.UserID == userID && (s.Visibility != models.VisibilityOrg || isMember(s.OrgID, userID))
+	}, limit, offset)
+}
+
+func (m *SnippetModel) ByOrg(orgID int, member bool, limit, offset int) ([]*models.Snippet, int, error) {
+	return page(mockSnippets, func(s *models.Snippet) bool {
+		return s.OrgID == orgID && !s.Expired() && (member || s.Visibility == models.VisibilityPublic)
+	}, limit, offset)
+}
+
+// mockStars records which snippets each user has starred, by ID.
+var mockStars = map[int][]int{
+	1: {1, 5, 7, 13},
+	2: {1},
+}
+
+func (m *SnippetModel) Star(snippetID, userID int) error {
+	return nil
+}
+
+func (m *SnippetModel) Unstar(snippetID, userID int) error {
+	return nil
+}
+
+func (m *SnippetModel) IsStarred(snippetID, userID int) (bool, error) {
+	return slices.Contains(mockStars[userID], snippetID), nil
+}
+
+func (m *SnippetModel) Starred(userID int, includeUnlisted bool, limit, offset int) ([]*models.Snippet, int, error) {
+	return page(mockSnippets, func(s *models.Snippet) bool {
+		if !slices.Contains(mockStars[userID], s.ID) || s.Expired() {
+			return false
+		}
+		if includeUnlisted {
+			switch s.Visibility {
+			case models.VisibilityPrivate:
+				return s.UserID == userID
+			case models.VisibilityOrg:
+				return isMember(s.OrgID, userID)
+			default:
+				return true
+			}
+		}
+		return s.Visibility == models.VisibilityPublic
+	}, limit, offset)
+}
+
+func (m *SnippetModel) MostStarred(period time.Duration, limit int) ([]*models.Snippet, error) {
+	return []*models.Snippet{mockSnippet, mockForkSnippet}, nil
+}
+
+func (m *SnippetModel) TagCloud(limit int) ([]*models.Tag, error) {
+	tags := []*models.Tag{
+		{Name: "haiku", Count: 2},
+		{Name: "poetry", Count: 1},
+	}
+	models.WeighTags(tags)
+	return tags[:min(limit, len(tags))], nil
+}
+
+func (m *SnippetModel) Search(query string) ([]*models.Snippet, error) {
+	if strings.Contains(mockSnippet.Title, query) || strings.Contains(mockSnippet.Content, query) {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Count() (int, int, error) {
+	return 1, 1, nil
+}
+
+func (m *SnippetModel) Burn(id int) (*models.Snippet, error) {
+	switch id {
+	case 4:
+		return clone(mockBurnSnippet), nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
@@ -1,31 +1,131 @@
 package mocks
 
-import "snippetbox.linze.me/internal/models"
+import (
+	"strings"
+	"time"
+
+	"snippetbox.linze.me/internal/models"
+)
+
+var mockUser = &models.User{
+	ID:       1,
+	Name:     "Alice",
+	Username: "alice",
+	Email:    "alice@email.com",
+	Created:  time.Now(),
+	Role:     models.RoleUser,
+}
+
+var mockAdmin = &models.User{
+	ID:       2,
+	Name:     "Bob",
+	Username: "bob",
+	Email:    "bob@email.com",
+	Created:  time.Now(),
+	Role:     models.RoleAdmin,
+}
 
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
-	switch email{
-	case "dupe@email.com":
+func (m *UserModel) Insert(name, username, email, password string) error {
+	switch {
+	case email == "dupe@email.com":
 		return models.ErrDuplicateEmail
+	case username == "alice" || username == "bob":
+		return models.ErrDuplicateUsername
 	default:
 		return nil
 	}
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "alice@email.com" && password == "pa$$word" {
+func (m *UserModel) InsertExternal(name, username, email string) (int, error) {
+	switch {
+	case email == "dupe@email.com":
+		return 0, models.ErrDuplicateEmail
+	case username == "alice" || username == "bob":
+		return 0, models.ErrDuplicateUsername
+	default:
+		return 3, nil
+	}
+}
+
+func (m *UserModel) Authenticate(login, password string) (int, error) {
+	if (login == "alice@email.com" || login == "alice") && password == "pa$$word" {
 		return 1, nil
 	}
+	if (login == "bob@email.com" || login == "bob") && password == "pa$$word" {
+		return 2, nil
+	}
 
 	return 0, models.ErrInvalidCredentials
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 2:
 		return true, nil
 	default:
 		return false, nil
 	}
-}
\ No newline at end of file
+}
+
+func (m *UserModel) Get(id int) (*models.User, error) {
+	switch id {
+	case 1:
+		return mockUser, nil
+	case 2:
+		return mockAdmin, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+// Like MySQL's default collation, GetByUsername() is case-insensitive.
+func (m *UserModel) GetByUsername(username string) (*models.User, error) {
+	switch strings.ToLower(username) {
+	case "alice":
+		return mockUser, nil
+	case "bob":
+		return mockAdmin, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	switch email {
+	case "alice@email.com":
+		return mockUser, nil
+	case "bob@email.com":
+		return mockAdmin, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+// Like the real model, SetRole() only fails if there's no such user -- giving a user the role they already have succeeds.
+func (m *UserModel) SetRole(email, role string) error {
+	switch email {
+	case "alice@email.com", "bob@email.com":
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) All() ([]*models.User, error) {
+	return []*models.User{mockAdmin, mockUser}, nil
+}
+
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	switch id {
+	case 1, 2:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) Count() (int, int, error) {
+	return 2, 0, nil
+}
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Define an Org type to hold an organization: a group of users who share ownership of snippets. Organizations are identified in URLs
+// by their slug, which like a username is chosen when the organization is created. They're stored in the orgs table, and their members
+// in the org_members table:
+//
+//	CREATE TABLE orgs (
+//		id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		slug VARCHAR(30) NOT NULL,
+//		name VARCHAR(100) NOT NULL,
+//		created DATETIME NOT NULL
+//	);
+//	CREATE UNIQUE INDEX orgs_uc_slug ON orgs (slug);
+//
+//	CREATE TABLE org_members (
+//		org_id INTEGER NOT NULL,
+//		user_id INTEGER NOT NULL,
+//		role VARCHAR(10) NOT NULL,
+//		created DATETIME NOT NULL,
+//		PRIMARY KEY (org_id, user_id)
+//	);
+//	CREATE INDEX idx_org_members_user_id ON org_members (user_id);
+//
+// Snippets can be owned by an organization as well as by the user who created them, which is recorded in:
+//
+//	ALTER TABLE snippets ADD org_id INTEGER NULL;
+//	CREATE INDEX idx_snippets_org_id ON snippets(org_id);
+type Org struct {
+	ID      int
+	Slug    string
+	Name    string
+	Created time.Time
+	Role    string // the role of the user the organization was loaded for, only set by ForUser()
+}
+
+// Define a Member type to hold a member of an organization, along with their role in it.
+type Member struct {
+	UserID   int
+	Name     string
+	Username string
+	Role     string
+	Created  time.Time // when they joined the organization
+}
+
+// Define the roles which members of an organization can have. Every member can view and edit the organization's snippets,
+// but only owners can manage its members.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+)
+
+// OrgRoles contains all of the valid roles for members of an organization.
+var OrgRoles = []string{OrgRoleOwner, OrgRoleMember}
+
+// OrgSlugRX matches a valid organization slug. The rules are the same as for usernames: 3 to 30 lowercase letters, digits,
+// hyphens and underscores, starting with a letter.
+var OrgSlugRX = regexp.MustCompile(`^[a-z][a-z0-9_-]{2,29}$`)
+
+// The inMemberOrg constant is a condition which is true for snippets owned by an organization that the user given as its argument is currently a member of.
+// Members-only snippets have to be checked against it wherever they're listed, since the user who created one might have left the organization since.
+const inMemberOrg = `org_id IN (SELECT org_id FROM org_members WHERE user_id = ?)`
+
+// Define an OrgModel type which wraps a database connection pool.
+type OrgModel struct {
+	DB *sql.DB
+}
+
+type OrgModelInterface interface {
+	Insert(o *Org, ownerID int) error
+	Get(id int) (*Org, error)
+	GetBySlug(slug string) (*Org, error)
+	ForUser(userID int) ([]*Org, error)
+	Roles(userID int) (map[int]string, error)
+	Members(orgID int) ([]*Member, error)
+	SetMember(orgID, userID int, role string) error
+	RemoveMember(orgID, userID int) error
+}
+
+// This will insert a new organization, with the given user as its first owner. When it has been inserted, its ID is set on o.
+// If the slug is already taken, it returns ErrDuplicateSlug.
+func (m *OrgModel) Insert(o *Org, ownerID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO orgs (slug, name, created) VALUES(?, ?, UTC_TIMESTAMP())", o.Slug, o.Name)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "orgs_uc_slug") {
+			return ErrDuplicateSlug
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO org_members (org_id, user_id, role, created) VALUES(?, ?, ?, UTC_TIMESTAMP())", id, ownerID, OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	o.ID = int(id)
+	return nil
+}
+
+// This will return a specific organization based on its ID.
+func (m *OrgModel) Get(id int) (*Org, error) {
+	return m.getWhere("id = ?", id)
+}
+
+// This will return a specific organization based on its slug.
+func (m *OrgModel) GetBySlug(slug string) (*Org, error) {
+	return m.getWhere("slug = ?", slug)
+}
+
+func (m *OrgModel) getWhere(condition string, arg any) (*Org, error) {
+	o := &Org{}
+	err := m.DB.QueryRow("SELECT id, slug, name, created FROM orgs WHERE "+condition, arg).Scan(&o.ID, &o.Slug, &o.Name, &o.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// This will return the organizations which a user is a member of, in alphabetical order, with their Role set to the user's role.
+func (m *OrgModel) ForUser(userID int) ([]*Org, error) {
+	statement := `SELECT o.id, o.slug, o.name, o.created, om.role FROM orgs o
+	INNER JOIN org_members om ON om.org_id = o.id
+	WHERE om.user_id = ? ORDER BY o.name, o.id`
+
+	rows, err := m.DB.Query(statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Org{}
+	for rows.Next() {
+		o := &Org{}
+		err = rows.Scan(&o.ID, &o.Slug, &o.Name, &o.Created, &o.Role)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// This will return the user's role in each of the organizations they're a member of, by organization ID.
+// It's called for every request from an authenticated user, so that permission checks don't need to go to the database.
+func (m *OrgModel) Roles(userID int) (map[int]string, error) {
+	rows, err := m.DB.Query("SELECT org_id, role FROM org_members WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := map[int]string{}
+	for rows.Next() {
+		var orgID int
+		var role string
+		err = rows.Scan(&orgID, &role)
+		if err != nil {
+			return nil, err
+		}
+		roles[orgID] = role
+	}
+
+	return roles, rows.Err()
+}
+
+// This will return the members of an organization, owners first and then in order of joining.
+func (m *OrgModel) Members(orgID int) ([]*Member, error) {
+	statement := `SELECT u.id, u.name, u.username, om.role, om.created FROM org_members om
+	INNER JOIN users u ON u.id = om.user_id
+	WHERE om.org_id = ? ORDER BY om.role = 'owner' DESC, om.created, u.id`
+
+	rows, err := m.DB.Query(statement, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+	for rows.Next() {
+		mb := &Member{}
+		err = rows.Scan(&mb.UserID, &mb.Name, &mb.Username, &mb.Role, &mb.Created)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, mb)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// This will add a user to an organization with the given role, or change their role if they're already a member.
+func (m *OrgModel) SetMember(orgID, userID int, role string) error {
+	statement := `INSERT INTO org_members (org_id, user_id, role, created)
+	VALUES(?, ?, ?, UTC_TIMESTAMP())
+	ON DUPLICATE KEY UPDATE role = VALUES(role)`
+
+	_, err := m.DB.Exec(statement, orgID, userID, role)
+	return err
+}
+
+// This will remove a user from an organization. The snippets they created for the organization stay with it.
+// Removing a user who isn't a member does nothing.
+func (m *OrgModel) RemoveMember(orgID, userID int) error {
+	_, err := m.DB.Exec("DELETE FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID)
+	return err
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Define a Revision type to hold a single version of a snippet's title and files.
+// A revision is recorded whenever a snippet is created or edited, in the snippet_revisions table:
+//
+//	CREATE TABLE snippet_revisions (
+//		id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		snippet_id INTEGER NOT NULL,
+//		user_id INTEGER NULL,
+//		title VARCHAR(100) NOT NULL,
+//		content TEXT NOT NULL,
+//		created DATETIME NOT NULL
+//	);
+//	CREATE INDEX idx_snippet_revisions_snippet_id ON snippet_revisions (snippet_id);
+//
+// Snippets which existed before revisions were introduced are given their first revision with:
+//
+//	INSERT INTO snippet_revisions (snippet_id, user_id, title, content, created)
+//	SELECT id, user_id, title, content, created FROM snippets;
+//
+// Like the snippet itself, a revision keeps the content of its first file in the content column, and all of its files in the snippet_revision_files table:
+//
+//	CREATE TABLE snippet_revision_files (
+//		id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		revision_id INTEGER NOT NULL,
+//		position INTEGER NOT NULL,
+//		name VARCHAR(100) NOT NULL,
+//		language VARCHAR(30) NOT NULL,
+//		content MEDIUMTEXT NOT NULL
+//	);
+//	CREATE UNIQUE INDEX snippet_revision_files_uc_position ON snippet_revision_files (revision_id, position);
+//
+// Revisions which were recorded before then only have the content of the first file, so they're given a single, unnamed file with it.
+type Revision struct {
+	ID        int
+	SnippetID int
+	Number    int // the position of the revision in the snippet's history, starting at 1
+	UserID    int
+	UserName  string // the name of the user who made the revision, or empty if they no longer exist
+	Title     string
+	Content   string // the content of the first file
+	Files     []*File
+	Created   time.Time
+}
+
+// The insertRevision() function records a new revision of a snippet, with a copy of each of its files, as part of a transaction which changes the snippet.
+func insertRevision(tx *sql.Tx, snippetID, userID int, title string, files []*File) error {
+	statement := `INSERT INTO snippet_revisions (snippet_id, user_id, title, content, created)
+	VALUES(?, NULLIF(?, 0), ?, ?, UTC_TIMESTAMP())`
+
+	result, err := tx.Exec(statement, snippetID, userID, title, files[0].Content)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	statement = `INSERT INTO snippet_revision_files (revision_id, position, name, language, content)
+	VALUES(?, ?, ?, ?, ?)`
+
+	for i, f := range files {
+		_, err = tx.Exec(statement, id, i, f.Name, f.Language, f.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The loadRevisionFiles() function loads the files for the revisions of a snippet, in order, using a single query.
+// Revisions without any files (because they were recorded before revisions had files) are given a single unnamed file with their content.
+func loadRevisionFiles(q queryer, snippetID int, revisions []*Revision) error {
+	byID := make(map[int]*Revision, len(revisions))
+	for _, r := range revisions {
+		r.Files = []*File{}
+		byID[r.ID] = r
+	}
+
+	statement := `SELECT rf.revision_id, rf.name, rf.language, rf.content FROM snippet_revision_files rf
+	INNER JOIN snippet_revisions r ON r.id = rf.revision_id
+	WHERE r.snippet_id = ?
+	ORDER BY rf.revision_id, rf.position`
+
+	rows, err := q.Query(statement, snippetID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		f := &File{}
+		err = rows.Scan(&id, &f.Name, &f.Language, &f.Content)
+		if err != nil {
+			return err
+		}
+		// Skip the files of any revision which was recorded after the revisions themselves were fetched.
+		if r, ok := byID[id]; ok {
+			r.Files = append(r.Files, f)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range revisions {
+		if len(r.Files) == 0 {
+			r.Files = []*File{{Content: r.Content}}
+		}
+	}
+
+	return nil
+}
+
+// This will return all of the revisions of a snippet, along with their files, newest first.
+func (m *SnippetModel) Revisions(snippetID int) ([]*Revision, error) {
+	statement := `SELECT r.id, r.snippet_id, COALESCE(r.user_id, 0), COALESCE(u.name, ''), r.title, r.content, r.created
+	FROM snippet_revisions r
+	LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ?
+	ORDER BY r.id DESC`
+
+	rows, err := m.DB.Query(statement, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		r := &Revision{}
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.UserID, &r.UserName, &r.Title, &r.Content, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Number the revisions, with the oldest being revision 1.
+	for i, r := range revisions {
+		r.Number = len(revisions) - i
+	}
+
+	err = loadRevisionFiles(m.DB, snippetID, revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Define a Session type to hold the details of a single logged-in session for a user.
+// The session data itself lives in the sessions table managed by the scs mysqlstore, which can't be queried by user,
+// so we keep track of which session tokens belong to which user in a separate user_sessions table:
+//
+//	CREATE TABLE user_sessions (
+//		id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		token CHAR(43) NOT NULL,
+//		user_id INTEGER NOT NULL,
+//		created DATETIME NOT NULL,
+//		last_seen DATETIME NOT NULL,
+//		ip VARCHAR(45) NOT NULL,
+//		user_agent VARCHAR(255) NOT NULL
+//	);
+//	CREATE UNIQUE INDEX user_sessions_uc_token ON user_sessions (token);
+//	CREATE INDEX idx_user_sessions_user_id ON user_sessions (user_id);
+type Session struct {
+	ID        int
+	Token     string
+	UserID    int
+	Created   time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+}
+
+// Define a SessionModel type which wraps a database connection pool.
+type SessionModel struct {
+	DB *sql.DB
+}
+
+type SessionModelInterface interface {
+	Insert(token string, userID int, ip, userAgent string) error
+	Touch(token string) error
+	Get(id, userID int) (*Session, error)
+	ForUser(userID int) ([]*Session, error)
+	Delete(token string) error
+}
+
+// We'll use the Insert method to record that a session token belongs to a user, when they log in.
+func (m *SessionModel) Insert(token string, userID int, ip, userAgent string) error {
+	// Truncate the user agent so that it fits in the column.
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	statement := `INSERT INTO user_sessions (token, user_id, created, last_seen, ip, user_agent)
+	VALUES(?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?, ?)`
+
+	_, err := m.DB.Exec(statement, token, userID, ip, userAgent)
+	if err != nil {
+		return err
+	}
+
+	// Take the opportunity to remove any rows for this user whose session has since expired and been removed from the sessions table.
+	statement = `DELETE FROM user_sessions WHERE user_id = ?
+	AND token NOT IN (SELECT token FROM sessions)`
+
+	_, err = m.DB.Exec(statement, userID)
+	return err
+}
+
+// The Touch method updates the last seen time for a session. To avoid a database write on every request, it only does so if the session hasn't been seen in the last minute.
+func (m *SessionModel) Touch(token string) error {
+	statement := `UPDATE user_sessions SET last_seen = UTC_TIMESTAMP()
+	WHERE token = ? AND last_seen < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 MINUTE)`
+
+	_, err := m.DB.Exec(statement, token)
+	return err
+}
+
+// The Get method returns a specific session, so long as it belongs to the given user.
+func (m *SessionModel) Get(id, userID int) (*Session, error) {
+	statement := `SELECT id, token, user_id, created, last_seen, ip, user_agent FROM user_sessions
+	WHERE id = ? AND user_id = ?`
+
+	s := &Session{}
+	err := m.DB.QueryRow(statement, id, userID).Scan(&s.ID, &s.Token, &s.UserID, &s.Created, &s.LastSeen, &s.IP, &s.UserAgent)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// The ForUser method returns all of a user's sessions which are still live in the session store, most recently used first.
+func (m *SessionModel) ForUser(userID int) ([]*Session, error) {
+	statement := `SELECT us.id, us.token, us.user_id, us.created, us.last_seen, us.ip, us.user_agent
+	FROM user_sessions us
+	INNER JOIN sessions s ON s.token = us.token
+	WHERE us.user_id = ? AND s.expiry > UTC_TIMESTAMP(6)
+	ORDER BY us.last_seen DESC`
+
+	rows, err := m.DB.Query(statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		s := &Session{}
+		err = rows.Scan(&s.ID, &s.Token, &s.UserID, &s.Created, &s.LastSeen, &s.IP, &s.UserAgent)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// The Delete method forgets about a session token. Note that this doesn't remove the session from the session store itself -- that's the responsibility of the caller.
+func (m *SessionModel) Delete(token string) error {
+	statement := "DELETE FROM user_sessions WHERE token = ?"
+
+	_, err := m.DB.Exec(statement, token)
+	return err
+}
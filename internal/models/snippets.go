@@ -1,70 +1,342 @@
 package models
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"errors"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// likeEscaper escapes the wildcard characters in a string, so that it can be safely used as part of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 // Define a Snippet type to hold the data for an individual snippet. Notice how
 // the fields of the struct correspond to the fields in our MySQL snippets table?
+//
+// The user who created the snippet is recorded in the user_id column, which is added with:
+//
+//	ALTER TABLE snippets ADD user_id INTEGER NULL;
+//	CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+//
+// Snippets created before user_id was added have no owner, and their UserID is 0.
+//
+// Who can see a snippet is controlled by its visibility, which is stored with:
+//
+//	ALTER TABLE snippets ADD visibility VARCHAR(10) NOT NULL DEFAULT 'public';
+//
+// Snippets are identified in URLs by a random slug rather than their sequential ID, so that they can't be enumerated.
+// Existing snippets are given a slug when the column is added with:
+//
+//	ALTER TABLE snippets ADD slug CHAR(12) NULL;
+//	UPDATE snippets SET slug = REPLACE(REPLACE(TO_BASE64(RANDOM_BYTES(9)), '+', '-'), '/', '_');
+//	ALTER TABLE snippets MODIFY slug CHAR(12) NOT NULL;
+//	CREATE UNIQUE INDEX snippets_uc_slug ON snippets(slug);
+//
+// Snippets can be deleted automatically the first time they are viewed, which is recorded with:
+//
+//	ALTER TABLE snippets ADD burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE;
+//
+// Snippets can optionally be protected with a password, which is stored as a bcrypt hash in:
+//
+//	ALTER TABLE snippets ADD hashed_password CHAR(60) NULL;
+//
+// Snippets can also be encrypted in the browser before they are sent to us, in which case the content column only ever holds ciphertext.
+// The key never reaches the server -- it's kept in the fragment of the snippet's URL. Encrypted snippets are flagged with:
+//
+//	ALTER TABLE snippets ADD encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+//
+// Snippets which never expire have a NULL expires column, which is allowed with:
+//
+//	ALTER TABLE snippets MODIFY expires DATETIME NULL;
+//
+// Snippets can be forked from another snippet, which is recorded in:
+//
+//	ALTER TABLE snippets ADD parent_id INTEGER NULL;
+//	CREATE INDEX idx_snippets_parent_id ON snippets(parent_id);
+//
+// Snippets can also be owned by an organization, as described with the Org type.
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID               int
+	Slug             string
+	Title            string
+	Content          string
+	Created          time.Time
+	Expires          *time.Time // nil if the snippet never expires
+	UserID           int
+	Visibility       string
+	BurnAfterReading bool
+	HashedPassword   []byte
+	Encrypted        bool
+	ParentID         int      // the ID of the snippet this one was forked from, or 0 if it wasn't forked
+	OrgID            int      // the ID of the organization which owns the snippet, or 0 if it's a personal snippet
+	Files            []*File  // only loaded for single snippets, not lists of them
+	Tags             []string // sorted by name
+	Stars            int      // the number of users who have starred the snippet
+}
+
+// EncryptedContentRX matches the content of an encrypted snippet, as produced by ui/static/js/crypto.js.
+// That's the 12-byte AES-GCM nonce and the ciphertext (including the 16-byte authentication tag), each base64url-encoded without padding and separated by a dot.
+var EncryptedContentRX = regexp.MustCompile(`^[A-Za-z0-9_-]{16}\.[A-Za-z0-9_-]{22,}$`)
+
+// HasPassword() returns true if the snippet is protected with a password.
+func (s *Snippet) HasPassword() bool {
+	return len(s.HashedPassword) > 0
+}
+
+// PasswordMatches() returns true if the given password matches the snippet's password.
+func (s *Snippet) PasswordMatches(password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(s.HashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		} else {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Expired() returns true if the snippet has expired. Most methods of SnippetModel never return expired snippets, but AllByUser() does.
+func (s *Snippet) Expired() bool {
+	return s.Expires != nil && !s.Expires.After(time.Now())
 }
 
+// Define the visibility levels for a snippet. Public snippets are listed on the home page,
+// unlisted snippets can be viewed by anyone who has the URL, and private snippets can only be viewed by their owner.
+// Snippets owned by an organization can instead be visible to the organization's members only.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+	VisibilityOrg      = "org"
+)
+
+// Visibilities contains all of the valid visibility levels for personal snippets.
+var Visibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
+// OrgVisibilities contains all of the valid visibility levels for snippets owned by an organization. They can't be private,
+// since the point of an organization's snippets is that its members share them.
+var OrgVisibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityOrg}
+
 // Define a SnippetModel type which wraps a sql.DB connection pool.
 type SnippetModel struct {
 	DB *sql.DB
 }
 
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error) 
+	Insert(s *Snippet, password string) error
+	Update(s *Snippet, userID int) error
+	Revisions(snippetID int) ([]*Revision, error)
 	Get(id int) (*Snippet, error)
+	GetBySlug(slug string) (*Snippet, error)
 	Latest() ([]*Snippet, error)
+	Forks(parentID int) ([]*Snippet, error)
+	Tagged(tag string, limit, offset int) ([]*Snippet, int, error)
+	ByUser(userID, limit, offset int) ([]*Snippet, int, error)
+	AllByUser(userID, limit, offset int) ([]*Snippet, int, error)
+	ByOrg(orgID int, member bool, limit, offset int) ([]*Snippet, int, error)
+	TagCloud(limit int) ([]*Tag, error)
+	Star(snippetID, userID int) error
+	Unstar(snippetID, userID int) error
+	IsStarred(snippetID, userID int) (bool, error)
+	Starred(userID int, includeUnlisted bool, limit, offset int) ([]*Snippet, int, error)
+	MostStarred(period time.Duration, limit int) ([]*Snippet, error)
+	Search(query string) ([]*Snippet, error)
+	Delete(id int) error
+	Count() (total, live int, err error)
+	Burn(id int) (*Snippet, error)
 }
 
-// This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// SlugRX matches the format of the slugs generated for snippets: 12 characters of URL-safe base64.
+var SlugRX = regexp.MustCompile(`^[A-Za-z0-9_-]{12}$`)
+
+// The generateSlug() function returns a new random slug, made from 9 bytes of cryptographically secure random data encoded as URL-safe base64.
+// We make sure that the slug isn't all digits, so that it can never be confused with an old-style numeric snippet ID.
+func generateSlug() (string, error) {
+	b := make([]byte, 9)
+
+	for {
+		_, err := rand.Read(b)
+		if err != nil {
+			return "", err
+		}
+
+		slug := base64.URLEncoding.EncodeToString(b)
+		if strings.Trim(slug, "0123456789") != "" {
+			return slug, nil
+		}
+	}
+}
+
+// This will insert a new snippet into the database, which expires at s.Expires (or never, if s.Expires is nil).
+// If password isn't empty, the snippet is protected with a bcrypt hash of the password.
+// If s.Files is empty the snippet is given a single unnamed file with s.Content; otherwise s.Content is set to the content of the first file.
+// The snippet is tagged with s.Tags, which should already have been normalized with ParseTags().
+// The ID, Slug, Created and HashedPassword fields of s are ignored. When the snippet has been inserted, its ID, newly generated Slug and HashedPassword are set on s.
+func (m *SnippetModel) Insert(s *Snippet, password string) error {
+	// Hash the password in the same way as we do for user passwords. If there's no password we store NULL in the hashed_password column.
+	var hashedPassword []byte
+	if password != "" {
+		var err error
+		hashedPassword, err = bcrypt.GenerateFromPassword([]byte(password), 12)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(s.Files) == 0 {
+		s.Files = []*File{{Content: s.Content}}
+	}
+	s.Content = s.Files[0].Content
+
+	// Times in the database are stored in UTC, so convert the expiry time before inserting it. A nil expiry time is stored as NULL.
+	var expires *time.Time
+	if s.Expires != nil {
+		utc := s.Expires.UTC()
+		expires = &utc
+	}
+
 	// Write the SQL statement we want to execute. I've split it over two lines
 	// for readability (which is why it's surrounded with backquotes instead of normal double quotes).
-	statement := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	statement := `INSERT INTO snippets (slug, title, content, created, expires, user_id, visibility, burn_after_reading, hashed_password, encrypted, parent_id, org_id)
+	VALUES(?, ?, ?, UTC_TIMESTAMP(), ?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, 0))`
+
+	// The snippet, its files, its tags and its first revision are inserted in a single transaction, so that every snippet has a complete revision history.
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// A collision between two random slugs is extremely unlikely, but if it does happen the insert will fail on the snippets_uc_slug constraint.
+	// In that case we simply try again with a new slug, up to a few times.
+	for attempt := 1; ; attempt++ {
+		slug, err := generateSlug()
+		if err != nil {
+			return err
+		}
+
+		// Use the Exec() method on the transaction to execute the statement.
+		result, err := tx.Exec(statement, slug, s.Title, s.Content, expires, s.UserID, s.Visibility, s.BurnAfterReading, hashedPassword, s.Encrypted, s.ParentID, s.OrgID)
+		if err != nil {
+			var mySQLError *mysql.MySQLError
+			if errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "snippets_uc_slug") && attempt < 3 {
+				continue
+			}
+			return err
+		}
+
+		// Use the LastInsertId() method on the result to get the ID of our newly inserted record in the snippets table.
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		err = insertFiles(tx, int(id), s.Files)
+		if err != nil {
+			return err
+		}
+
+		err = insertTags(tx, int(id), s.Tags)
+		if err != nil {
+			return err
+		}
+
+		err = insertRevision(tx, int(id), s.UserID, s.Title, s.Files)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		// The ID returned has the type int64, so we convert it to an int type.
+		s.ID = int(id)
+		s.Slug = slug
+		s.HashedPassword = hashedPassword
+		return nil
+	}
+}
 
-	// Use the Exec() method on the embedded connection pool to execute the
-	// statement. The first parameter is the SQL statement, followed by the
-	// title, content and expiry values for the placeholder parameters. This
-	// method returns a sql.Result type, which contains some basic
-	// information about what happened when the statement was executed.
-	result, err := m.DB.Exec(statement, title, content, expires)
+// This will update the title and files of a snippet, recording the new version as a revision made by the given user.
+// If s.Files is empty the snippet is given a single unnamed file with s.Content; otherwise s.Content is set to the content of the first file.
+// If nothing has changed, no revision is recorded.
+func (m *SnippetModel) Update(s *Snippet, userID int) error {
+	if len(s.Files) == 0 {
+		s.Files = []*File{{Content: s.Content}}
+	}
+	s.Content = s.Files[0].Content
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Fetch the current title and files, to check whether anything has changed. We can't use RowsAffected() for this,
+	// because only the content of the first file is stored in the snippets table.
+	current := &Snippet{ID: s.ID}
+	err = tx.QueryRow("SELECT title, content FROM snippets WHERE id = ? FOR UPDATE", s.ID).Scan(&current.Title, &current.Content)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	err = loadFiles(tx, current)
+	if err != nil {
+		return err
+	}
+
+	if current.Title == s.Title && slices.EqualFunc(current.Files, s.Files, func(a, b *File) bool { return *a == *b }) {
+		return nil
+	}
+
+	_, err = tx.Exec("UPDATE snippets SET title = ?, content = ? WHERE id = ?", s.Title, s.Content, s.ID)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	// Use the LastInsertId() method on the result to get the ID of our newly inserted record in the snippets table.
-	id, err := result.LastInsertId()
+	// Files can be added, removed and renamed, so it's simplest to replace all of them.
+	_, err = tx.Exec("DELETE FROM snippet_files WHERE snippet_id = ?", s.ID)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	// The ID returned has the type int64, so we convert it to an int type before returning.
-	return int(id), nil
+	err = insertFiles(tx, s.ID, s.Files)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, s.ID, userID, s.Title, s.Files)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// This will return a specific snippet based on its id.
-func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	statement := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+// notExpired is the SQL condition for snippets which haven't expired yet, including those which never expire.
+const notExpired = `(expires IS NULL OR expires > UTC_TIMESTAMP())`
 
-	// Use the QueryRow() method on the connection pool to execute our
-	// SQL statement, passing in the untrusted id variable as the value for the
-	// placeholder parameter. This returns a pointer to a sql.Row object which
-	// holds the result from the database.
-	row := m.DB.QueryRow(statement, id)
+// The snippetColumns constant lists the columns needed to populate a Snippet, in the order expected by scanSnippet().
+// All of the queries which return snippets select these columns, so that we only need to update one place when a column is added.
+const snippetColumns = `id, slug, title, content, created, expires, COALESCE(user_id, 0), visibility, burn_after_reading, hashed_password, encrypted, COALESCE(parent_id, 0),
+	COALESCE(org_id, 0), (SELECT COUNT(*) FROM snippet_stars WHERE snippet_stars.snippet_id = snippets.id)`
 
+// The scanSnippet() function copies the values from a row selected using snippetColumns into a new Snippet struct.
+// It accepts either a *sql.Row or *sql.Rows, since both have a Scan() method.
+func scanSnippet(row interface{ Scan(dest ...any) error }) (*Snippet, error) {
 	// Initialize a pointer to a new zeroed Snippet struct.
 	s := &Snippet{}
 
@@ -73,7 +345,21 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	// to row.Scan are *pointers* to the place you want to copy the data into,
 	// and the number of arguments must be exactly the same as the number of
 	// columns returned by your statement.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.Slug, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Visibility, &s.BurnAfterReading, &s.HashedPassword, &s.Encrypted, &s.ParentID, &s.OrgID, &s.Stars)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// The getSnippet() method executes a query which returns at most one snippet. If no matching record is found it returns ErrNoRecord.
+func (m *SnippetModel) getSnippet(statement string, args ...any) (*Snippet, error) {
+	// Use the QueryRow() method on the connection pool to execute our
+	// SQL statement, passing in the untrusted values for the
+	// placeholder parameters. This returns a pointer to a sql.Row object which
+	// holds the result from the database.
+	s, err := scanSnippet(m.DB.QueryRow(statement, args...))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -82,23 +368,29 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 		}
 	}
 
-	return s, nil
-}
+	err = loadFiles(m.DB, s)
+	if err != nil {
+		return nil, err
+	}
 
-// This will return the 10 most recently created snippets.
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
+	err = loadTags(m.DB, s)
+	if err != nil {
+		return nil, err
+	}
 
-	statement := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	return s, nil
+}
 
+// The querySnippets() method executes a query which returns any number of snippets.
+func (m *SnippetModel) querySnippets(statement string, args ...any) ([]*Snippet, error) {
 	// Use the Query() method on the connection pool to execute our SQL statement.
 	// This returns a sql.Rows results containing the result of our query.
-	rows, err := m.DB.Query(statement)
+	rows, err := m.DB.Query(statement, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	// We defer rows.Close() to ensure the sql.Rows results is always properly closed before the Latest() method returns.
+	// We defer rows.Close() to ensure the sql.Rows results is always properly closed before the method returns.
 	// This defer statement should come *after* you check for an error from the Query() method.
 	// Otherwise, if Query() returns an error, you'll get a panic trying to close a nil results.
 	defer rows.Close()
@@ -110,12 +402,7 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	// This prepares the first (and then each subsequent) row to be acted on by the rows.Scan() method.
 	// If iteration over all the rows completes then the results automatically closes itself and frees-up the underlying database connection.
 	for rows.Next() {
-		// Create a pointer to a new zeroed Snippet struct.
-		s := &Snippet{}
-		// Use rows.Scan() to copy the values from each field in the row to the new Snippet object that we created.
-		// Again, the arguments to row.Scan() must be pointers to the place you want to copy the data into,
-		// and the number of arguments must be exactly the same as the number of columns returned by your statement.
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		s, err := scanSnippet(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -129,5 +416,253 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 		return nil, err
 	}
 
+	// Load the tags for all of the snippets at once, so that lists of snippets can show them.
+	err = loadTags(m.DB, snippets...)
+	if err != nil {
+		return nil, err
+	}
+
 	return snippets, nil
 }
+
+// This will return a specific snippet based on its id.
+func (m *SnippetModel) Get(id int) (*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE ` + notExpired + ` AND id = ?`
+
+	return m.getSnippet(statement, id)
+}
+
+// This will return a specific snippet based on its slug.
+func (m *SnippetModel) GetBySlug(slug string) (*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE ` + notExpired + ` AND slug = ?`
+
+	return m.getSnippet(statement, slug)
+}
+
+// This will return the 10 most recently created public snippets.
+// Snippets which are burned after reading are never listed, here or anywhere else, because whoever found one could reveal it before its recipient.
+// New ones can't be public anyway, but older ones might be.
+func (m *SnippetModel) Latest() ([]*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE ` + notExpired + ` AND visibility = 'public' AND NOT burn_after_reading ORDER BY id DESC LIMIT 10`
+
+	return m.querySnippets(statement)
+}
+
+// This will return up to 50 of the most recent unexpired snippets which were forked from the given snippet, whatever their visibility.
+// It's up to the caller to only show the forks that the user is allowed to see.
+func (m *SnippetModel) Forks(parentID int) ([]*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE ` + notExpired + ` AND parent_id = ? ORDER BY id DESC LIMIT 50`
+
+	return m.querySnippets(statement, parentID)
+}
+
+// This will return a page of the live, public snippets created by a user, most recent first, along with the total number of them.
+func (m *SnippetModel) ByUser(userID, limit, offset int) ([]*Snippet, int, error) {
+	return m.pageOfSnippets(notExpired+` AND visibility = 'public' AND NOT burn_after_reading AND user_id = ?`, limit, offset, userID)
+}
+
+// This will return a page of all of the snippets created by a user, most recent first, along with the total number of them.
+// Unlike ByUser() it includes expired, unlisted and private snippets, so it should only be used to show a user their own snippets.
+// Members-only snippets are left out if the user is no longer a member of the organization, since they can't see them any more.
+func (m *SnippetModel) AllByUser(userID, limit, offset int) ([]*Snippet, int, error) {
+	return m.pageOfSnippets(`user_id = ? AND (visibility <> 'org' OR `+inMemberOrg+`)`, limit, offset, userID, userID)
+}
+
+// This will return a page of the live snippets owned by an organization, most recent first, along with the total number of them.
+// Only public snippets are included, unless member is true, in which case the organization's unlisted and members-only snippets are included too.
+// That should only be the case when a member of the organization is looking at them.
+func (m *SnippetModel) ByOrg(orgID int, member bool, limit, offset int) ([]*Snippet, int, error) {
+	if member {
+		return m.pageOfSnippets(notExpired+` AND org_id = ?`, limit, offset, orgID)
+	}
+	return m.pageOfSnippets(notExpired+` AND visibility = 'public' AND NOT burn_after_reading AND org_id = ?`, limit, offset, orgID)
+}
+
+// The pageOfSnippets() method returns a page of the snippets which match a condition, most recent first, along with the total number of them.
+func (m *SnippetModel) pageOfSnippets(condition string, limit, offset int, args ...any) ([]*Snippet, int, error) {
+	var total int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM snippets WHERE `+condition, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE ` + condition + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	snippets, err := m.querySnippets(statement, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, total, nil
+}
+
+// This will return up to 50 snippets whose title, or the name or content of one of their files, contains the query, most recent first.
+// Unlike Get() and Latest() it includes expired, unlisted and private snippets, because it's intended for use by admins.
+func (m *SnippetModel) Search(query string) ([]*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE title LIKE ? OR content LIKE ? OR id IN (SELECT snippet_id FROM snippet_files WHERE name LIKE ? OR content LIKE ?)
+	ORDER BY id DESC LIMIT 50`
+
+	// Escape any wildcard characters in the query, so that they are matched literally.
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+
+	return m.querySnippets(statement, pattern, pattern, pattern, pattern)
+}
+
+// This will delete a specific snippet along with its files, tags, stars, comments and revisions, whether or not it has expired.
+func (m *SnippetModel) Delete(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement := "DELETE FROM snippets WHERE id = ?"
+
+	result, err := tx.Exec(statement, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	_, err = tx.Exec("DELETE FROM snippet_files WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM snippet_tags WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM snippet_stars WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM comments WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM collection_snippets WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM snippet_revision_files WHERE revision_id IN (SELECT id FROM snippet_revisions WHERE snippet_id = ?)", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM snippet_revisions WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// This will return the total number of snippets in the database, and how many of them haven't expired yet.
+func (m *SnippetModel) Count() (total, live int, err error) {
+	statement := `SELECT COUNT(*), COALESCE(SUM` + notExpired + `, 0) FROM snippets`
+
+	err = m.DB.QueryRow(statement).Scan(&total, &live)
+	return total, live, err
+}
+
+// This will fetch and delete a specific snippet in a single transaction, for snippets which are burned after reading.
+// The SELECT ... FOR UPDATE locks the row, so if two requests try to burn the same snippet at the same time, the second one
+// will wait for the first to finish and then get ErrNoRecord -- meaning that only one request can ever see the content.
+func (m *SnippetModel) Burn(id int) (*Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Defer a call to tx.Rollback() to ensure it is always called before the function returns.
+	// If the transaction succeeds it will have already been committed by the time tx.Rollback() is called, making it a no-op.
+	defer tx.Rollback()
+
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE ` + notExpired + ` AND id = ? FOR UPDATE`
+
+	s, err := scanSnippet(tx.QueryRow(statement, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	err = loadFiles(tx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadTags(tx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM snippets WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files and revisions hold copies of the content, so they need to be burned too.
+	_, err = tx.Exec("DELETE FROM snippet_files WHERE snippet_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM snippet_tags WHERE snippet_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM snippet_stars WHERE snippet_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM comments WHERE snippet_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM collection_snippets WHERE snippet_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM snippet_revision_files WHERE revision_id IN (SELECT id FROM snippet_revisions WHERE snippet_id = ?)", id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM snippet_revisions WHERE snippet_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
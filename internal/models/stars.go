@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// Users can star snippets to bookmark them. Each star is a row in the snippet_stars table:
+//
+//	CREATE TABLE snippet_stars (
+//		snippet_id INTEGER NOT NULL,
+//		user_id INTEGER NOT NULL,
+//		created DATETIME NOT NULL,
+//		PRIMARY KEY (snippet_id, user_id)
+//	);
+//	CREATE INDEX idx_snippet_stars_user_id ON snippet_stars (user_id);
+//	CREATE INDEX idx_snippet_stars_created ON snippet_stars (created);
+//
+// The number of stars a snippet has is loaded into Snippet.Stars along with the rest of its columns (see snippetColumns).
+
+// This will star a snippet on behalf of a user. Starring a snippet which the user has already starred does nothing.
+func (m *SnippetModel) Star(snippetID, userID int) error {
+	statement := `INSERT INTO snippet_stars (snippet_id, user_id, created)
+	VALUES(?, ?, UTC_TIMESTAMP())
+	ON DUPLICATE KEY UPDATE snippet_id = snippet_id`
+
+	_, err := m.DB.Exec(statement, snippetID, userID)
+	return err
+}
+
+// This will remove a user's star from a snippet. Unstarring a snippet which the user hasn't starred does nothing.
+func (m *SnippetModel) Unstar(snippetID, userID int) error {
+	_, err := m.DB.Exec("DELETE FROM snippet_stars WHERE snippet_id = ? AND user_id = ?", snippetID, userID)
+	return err
+}
+
+// This will return true if the user has starred the snippet.
+func (m *SnippetModel) IsStarred(snippetID, userID int) (bool, error) {
+	var starred bool
+
+	statement := "SELECT EXISTS(SELECT true FROM snippet_stars WHERE snippet_id = ? AND user_id = ?)"
+
+	err := m.DB.QueryRow(statement, snippetID, userID).Scan(&starred)
+	return starred, err
+}
+
+// This will return a page of the live snippets starred by a user, most recent first, along with the total number of them.
+// Only public snippets are included, unless includeUnlisted is true, in which case the user's starred unlisted snippets, their own
+// private snippets and the members-only snippets of organizations they're still a member of are included too.
+// That should only be the case when the user is looking at their own stars.
+func (m *SnippetModel) Starred(userID int, includeUnlisted bool, limit, offset int) ([]*Snippet, int, error) {
+	condition := notExpired + ` AND id IN (SELECT snippet_id FROM snippet_stars WHERE user_id = ?)`
+	args := []any{userID}
+
+	if includeUnlisted {
+		condition += ` AND (visibility IN ('public', 'unlisted') OR (visibility = 'private' AND user_id = ?) OR (visibility = 'org' AND ` + inMemberOrg + `))`
+		args = append(args, userID, userID)
+	} else {
+		condition += ` AND visibility = 'public' AND NOT burn_after_reading`
+	}
+
+	return m.pageOfSnippets(condition, limit, offset, args...)
+}
+
+// This will return up to limit of the live, public snippets which received the most stars in the given period up to now, most starred first.
+func (m *SnippetModel) MostStarred(period time.Duration, limit int) ([]*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets
+	INNER JOIN (
+		SELECT snippet_id, COUNT(*) AS recent FROM snippet_stars
+		WHERE created > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)
+		GROUP BY snippet_id
+	) AS recent_stars ON recent_stars.snippet_id = snippets.id
+	WHERE ` + notExpired + ` AND visibility = 'public' AND NOT burn_after_reading
+	ORDER BY recent_stars.recent DESC, id DESC LIMIT ?`
+
+	return m.querySnippets(statement, int(period.Seconds()), limit)
+}
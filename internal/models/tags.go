@@ -0,0 +1,169 @@
+package models
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+)
+
+// Snippets can be categorised with any number of tags. The tags themselves are stored once each in the tags table,
+// and linked to snippets through the snippet_tags table:
+//
+//	CREATE TABLE tags (
+//		id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		name VARCHAR(30) NOT NULL
+//	);
+//	CREATE UNIQUE INDEX tags_uc_name ON tags (name);
+//
+//	CREATE TABLE snippet_tags (
+//		snippet_id INTEGER NOT NULL,
+//		tag_id INTEGER NOT NULL,
+//		PRIMARY KEY (snippet_id, tag_id)
+//	);
+//	CREATE INDEX idx_snippet_tags_tag_id ON snippet_tags (tag_id);
+//
+// Define a Tag type to hold a tag and the number of live, public snippets which use it, for the tag cloud.
+type Tag struct {
+	Name   string
+	Count  int
+	Weight int // from 1 (least used) to 5 (most used), relative to the other tags in the cloud
+}
+
+// TagRX matches a valid tag name: 1 to 30 lowercase letters, digits and hyphens, starting with a letter or digit.
+// Tags are used in URLs (like /tags/go), so they're kept to characters which don't need escaping.
+var TagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,29}$`)
+
+// ParseTags() splits a comma-separated list of tags, as entered by a user, into individual tags.
+// Each tag is trimmed and lowercased, and blank and duplicate tags are dropped. It doesn't check that the tags are valid.
+func ParseTags(s string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// The insertTags() function links a new snippet to its tags, creating any tags which don't exist yet, as part of the transaction which inserts the snippet.
+func insertTags(tx *sql.Tx, snippetID int, tags []string) error {
+	for _, tag := range tags {
+		// The no-op update means that an existing tag is left alone, rather than the insert failing on the tags_uc_name constraint.
+		_, err := tx.Exec("INSERT INTO tags (name) VALUES(?) ON DUPLICATE KEY UPDATE name = name", tag)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO snippet_tags (snippet_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", snippetID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The loadTags() function loads the tags for any number of snippets in a single query, sorted by name.
+func loadTags(q queryer, snippets ...*Snippet) error {
+	if len(snippets) == 0 {
+		return nil
+	}
+
+	// Build the list of placeholders for the IN clause, and keep track of which snippet each ID belongs to.
+	byID := make(map[int]*Snippet, len(snippets))
+	args := make([]any, len(snippets))
+	for i, s := range snippets {
+		s.Tags = []string{}
+		byID[s.ID] = s
+		args[i] = s.ID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(snippets)), ", ")
+
+	statement := `SELECT st.snippet_id, t.name FROM snippet_tags st
+	INNER JOIN tags t ON t.id = st.tag_id
+	WHERE st.snippet_id IN (` + placeholders + `)
+	ORDER BY t.name`
+
+	rows, err := q.Query(statement, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			return err
+		}
+		byID[id].Tags = append(byID[id].Tags, name)
+	}
+
+	return rows.Err()
+}
+
+// This will return a page of the live, public snippets with the given tag, most recent first, along with the total number of them.
+func (m *SnippetModel) Tagged(tag string, limit, offset int) ([]*Snippet, int, error) {
+	condition := notExpired + ` AND visibility = 'public' AND NOT burn_after_reading
+	AND id IN (SELECT st.snippet_id FROM snippet_tags st INNER JOIN tags t ON t.id = st.tag_id WHERE t.name = ?)`
+
+	return m.pageOfSnippets(condition, limit, offset, tag)
+}
+
+// This will return up to limit of the tags used by the most live, public snippets, in alphabetical order, for the tag cloud.
+// Tags which are only used by expired, unlisted or private snippets aren't included, so that the cloud never gives them away.
+func (m *SnippetModel) TagCloud(limit int) ([]*Tag, error) {
+	statement := `SELECT name, uses FROM (
+		SELECT t.name, COUNT(*) AS uses FROM tags t
+		INNER JOIN snippet_tags st ON st.tag_id = t.id
+		INNER JOIN snippets s ON s.id = st.snippet_id
+		WHERE ` + notExpired + ` AND s.visibility = 'public' AND NOT s.burn_after_reading
+		GROUP BY t.id, t.name
+		ORDER BY uses DESC, t.name LIMIT ?
+	) AS top ORDER BY name`
+
+	rows, err := m.DB.Query(statement, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		t := &Tag{}
+		err = rows.Scan(&t.Name, &t.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	WeighTags(tags)
+	return tags, nil
+}
+
+// WeighTags() sets the Weight of each tag from 1 to 5, in proportion to how many snippets use it compared to the most used tag.
+func WeighTags(tags []*Tag) {
+	most := 0
+	for _, t := range tags {
+		most = max(most, t.Count)
+	}
+
+	for _, t := range tags {
+		t.Weight = 1
+		if most > 0 {
+			t.Weight = 1 + (t.Count*4)/most
+		}
+	}
+}
@@ -10,12 +10,61 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Define the roles which a user can have. Each role includes all the permissions of the roles before it.
+// The role is stored in the users table with:
+//
+//	ALTER TABLE users ADD role VARCHAR(20) NOT NULL DEFAULT 'user';
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles contains all of the valid roles, in order of increasing privilege.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// Accounts can be disabled by an admin, which is recorded with:
+//
+//	ALTER TABLE users ADD disabled BOOLEAN NOT NULL DEFAULT FALSE;
+//
+// Every user has a unique username, which is used in the URL of their profile and can be used instead of their email address to log in.
+// Existing users are given a username based on their ID when the column is added with:
+//
+//	ALTER TABLE users ADD username VARCHAR(30) NULL;
+//	UPDATE users SET username = CONCAT('user', id);
+//	ALTER TABLE users MODIFY username VARCHAR(30) NOT NULL;
+//	CREATE UNIQUE INDEX users_uc_username ON users (username);
+//
+// Users who sign up by logging in with single sign-on don't have a password, so their hashed_password is empty and they can't log in with one.
 type User struct {
-	ID int
-	Name string
-	Email string
+	ID             int
+	Name           string
+	Username       string
+	Email          string
 	HashedPassword []byte
-	Created time.Time
+	Created        time.Time
+	Role           string
+	Disabled       bool
+	// SnippetCount is the number of snippets the user has created. It's only populated by the All() method.
+	SnippetCount int
+}
+
+// HasRole() returns true if the user has the given role, or a more privileged one.
+func (u *User) HasRole(role string) bool {
+	if u == nil {
+		return false
+	}
+	return roleRank(u.Role) >= roleRank(role)
+}
+
+// roleRank() returns the position of a role in the Roles slice, or -1 if it isn't a valid role.
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
 }
 
 // Define a new UserModel type which wraps a database connection pool.
@@ -24,46 +73,76 @@ type UserModel struct {
 }
 
 type UserModelInterface interface {
-	Insert(name, email, password string) error
-	Authenticate(email, password string) (int, error)
+	Insert(name, username, email, password string) error
+	InsertExternal(name, username, email string) (int, error)
+	Authenticate(login, password string) (int, error)
 	Exists(id int) (bool, error)
+	Get(id int) (*User, error)
+	GetByUsername(username string) (*User, error)
+	GetByEmail(email string) (*User, error)
+	SetRole(email, role string) error
+	All() ([]*User, error)
+	SetDisabled(id int, disabled bool) error
+	Count() (total, disabled int, err error)
 }
 
 // We'll use the Insert method to add a new record to the "users" table.
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(name, username, email, password string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return err
 	}
 
-	statement := `INSERT INTO users (name, email, hashed_password, created)
-	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	_, err = m.insert(name, username, email, string(hashedPassword))
+	return err
+}
+
+// The InsertExternal method adds a user who logs in with single sign-on, so doesn't have a password, and returns their ID.
+func (m *UserModel) InsertExternal(name, username, email string) (int, error) {
+	return m.insert(name, username, email, "")
+}
+
+func (m *UserModel) insert(name, username, email, hashedPassword string) (int, error) {
+	statement := `INSERT INTO users (name, username, email, hashed_password, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
 
 	// Use the Exec() method to insert the user details and hashed password into the users table.
-	_, err = m.DB.Exec(statement, name, email, string(hashedPassword))
+	result, err := m.DB.Exec(statement, name, username, email, hashedPassword)
 	if err != nil {
-		// If this returns an error, we use the errors.As() function to check whether the error has the type *mysql.MySQLError. 
-		// If it does, the error will be assigned to the mySQLError variable. 
+		// If this returns an error, we use the errors.As() function to check whether the error has the type *mysql.MySQLError.
+		// If it does, the error will be assigned to the mySQLError variable.
 		// We can then check whether or not the error relates to our users_uc_email key by checking if the error code equals 1062 and the contents of the error message string. If it does, we return an ErrDuplicateEmail error.
 		var mySQLError *mysql.MySQLError
 		if errors.As(err, &mySQLError) {
 			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
+				return 0, ErrDuplicateEmail
+			}
+			// Likewise, a violation of the users_uc_username key means that the username has already been taken.
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_username") {
+				return 0, ErrDuplicateUsername
 			}
 		}
-		return err
+		return 0, err
+
+	}
 
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
 	}
-	return nil
+
+	return int(id), nil
 }
 
-// We'll use the Authenticate method to verify whether a user exists with the provided email address and password. This will return the relevant user ID if they do.
-func (m *UserModel) Authenticate(email, password string) (int, error) {
-	// Retrieve the id and hashed password associated with the given email. If no matching email exists we return the ErrInvalidCredentials error.
+// We'll use the Authenticate method to verify whether a user exists with the provided login and password. This will return the relevant user ID if they do.
+// The login can be either the user's email address or their username. Usernames can't contain an @, so the two can never be confused.
+func (m *UserModel) Authenticate(login, password string) (int, error) {
+	// Retrieve the id and hashed password associated with the given login. If no matching user exists we return the ErrInvalidCredentials error.
 	var id int
 	var hashedPassword []byte
-	statement := "SELECT id, hashed_password FROM users WHERE email = ?"
-	err := m.DB.QueryRow(statement,email).Scan(&id, &hashedPassword)
+	var disabled bool
+	statement := "SELECT id, hashed_password, disabled FROM users WHERE email = ? OR username = ?"
+	err := m.DB.QueryRow(statement, login, login).Scan(&id, &hashedPassword, &disabled)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -72,6 +151,11 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		}
 	}
 
+	// Users who signed up with single sign-on don't have a password at all.
+	if len(hashedPassword) == 0 {
+		return 0, ErrInvalidCredentials
+	}
+
 	// Check whether the hashed password and plain-text password provided match. If they don't, we return the ErrInvalidCredentials error.
 	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
 	if err != nil {
@@ -82,6 +166,11 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		}
 	}
 
+	// If the password is correct but the account has been disabled, we return the ErrAccountDisabled error.
+	if disabled {
+		return 0, ErrAccountDisabled
+	}
+
 	// Otherwise, the password is correct. Return the user ID.
 	return id, nil
 }
@@ -94,4 +183,110 @@ func (m *UserModel) Exists(id int) (bool, error) {
 
 	err := m.DB.QueryRow(stmt, id).Scan(&exists)
 	return exists, err
-}
\ No newline at end of file
+}
+
+// We'll use the Get method to fetch the details for a specific user based on their user ID.
+func (m *UserModel) Get(id int) (*User, error) {
+	statement := `SELECT id, name, username, email, created, role, disabled FROM users WHERE id = ?`
+
+	return m.getUser(statement, id)
+}
+
+// We'll use the GetByUsername method to fetch the details for a specific user based on their username.
+func (m *UserModel) GetByUsername(username string) (*User, error) {
+	statement := `SELECT id, name, username, email, created, role, disabled FROM users WHERE username = ?`
+
+	return m.getUser(statement, username)
+}
+
+// The GetByEmail method fetches the details for a specific user based on their email address.
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	statement := `SELECT id, name, username, email, created, role, disabled FROM users WHERE email = ?`
+
+	return m.getUser(statement, email)
+}
+
+// The getUser() method executes a query which returns at most one user. If no matching record is found it returns ErrNoRecord.
+func (m *UserModel) getUser(statement string, args ...any) (*User, error) {
+	u := &User{}
+	err := m.DB.QueryRow(statement, args...).Scan(&u.ID, &u.Name, &u.Username, &u.Email, &u.Created, &u.Role, &u.Disabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// The SetRole method changes the role of the user with the given email address. If there is no such user it returns ErrNoRecord.
+func (m *UserModel) SetRole(email, role string) error {
+	// Note that we can't use RowsAffected() to check whether the user exists, because MySQL reports zero rows affected if the user already has the role.
+	var exists bool
+	err := m.DB.QueryRow("SELECT EXISTS(SELECT true FROM users WHERE email = ?)", email).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoRecord
+	}
+
+	_, err = m.DB.Exec("UPDATE users SET role = ? WHERE email = ?", role, email)
+	return err
+}
+
+// The All method returns every user, along with the number of snippets they have created, most recent signups first.
+func (m *UserModel) All() ([]*User, error) {
+	statement := `SELECT u.id, u.name, u.username, u.email, u.created, u.role, u.disabled, COUNT(s.id)
+	FROM users u
+	LEFT JOIN snippets s ON s.user_id = u.id
+	GROUP BY u.id
+	ORDER BY u.id DESC`
+
+	rows, err := m.DB.Query(statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		u := &User{}
+		err = rows.Scan(&u.ID, &u.Name, &u.Username, &u.Email, &u.Created, &u.Role, &u.Disabled, &u.SnippetCount)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// The SetDisabled method disables or re-enables a user's account. If there is no such user it returns ErrNoRecord.
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	exists, err := m.Exists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoRecord
+	}
+
+	_, err = m.DB.Exec("UPDATE users SET disabled = ? WHERE id = ?", disabled, id)
+	return err
+}
+
+// The Count method returns the total number of users, and how many of them have been disabled.
+func (m *UserModel) Count() (total, disabled int, err error) {
+	statement := "SELECT COUNT(*), COALESCE(SUM(disabled), 0) FROM users"
+
+	err = m.DB.QueryRow(statement).Scan(&total, &disabled)
+	return total, disabled, err
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Define a Limiter interface which decides whether a request identified by key is allowed to proceed.
+// If it isn't, retryAfter holds how long the client should wait before trying again.
+// Keeping this as an interface means we can swap the in-memory implementation for one backed by a shared store (like Redis or MySQL) when running more than one instance of the application.
+type Limiter interface {
+	Allow(key string) (ok bool, retryAfter time.Duration, err error)
+}
+
+// A bucket holds the state for a single key: how many tokens are left and when it was last refilled.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Define a Memory type which implements a token-bucket Limiter, with all buckets held in memory.
+// Each key gets a bucket holding up to burst tokens, which refills at a steady rate (stored in tokens per second).
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	rate    float64 // tokens per second
+	burst   float64
+	now     func() time.Time
+}
+
+// NewMemory returns a new in-memory limiter which allows events requests every per,
+// with bursts of up to burst requests. All three must be greater than zero, otherwise the bucket would never refill.
+func NewMemory(events int, per time.Duration, burst int) *Memory {
+	return &Memory{
+		buckets: make(map[string]*bucket),
+		rate:    float64(events) / per.Seconds(),
+		burst:   float64(burst),
+		now:     time.Now,
+	}
+}
+
+// Allow() takes a token from the bucket for the given key, creating a full bucket if it doesn't exist yet.
+// If the bucket is empty it returns false, along with the time until the next token will be available.
+func (m *Memory) Allow(key string) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: m.burst, last: now}
+		m.buckets[key] = b
+	}
+
+	// Refill the bucket based on the time elapsed since we last saw this key, without going over the burst size.
+	b.tokens = math.Min(m.burst, b.tokens+now.Sub(b.last).Seconds()*m.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+
+	wait := time.Duration((1 - b.tokens) / m.rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// Cleanup() removes any stale buckets from memory.
+// A bucket which has been idle long enough to refill completely is indistinguishable from a new one, so nothing is lost by deleting it.
+func (m *Memory) Cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for key, b := range m.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*m.rate >= m.burst {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// StartCleanup() runs Cleanup() in a background goroutine every interval.
+// It returns a function which stops the goroutine.
+func (m *Memory) StartCleanup(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m.Cleanup()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"snippetbox.linze.me/internal/assert"
+)
+
+// newTestMemory returns a limiter whose clock only moves when the returned function is called.
+func newTestMemory(events int, per time.Duration, burst int) (*Memory, func(time.Duration)) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	m := NewMemory(events, per, burst)
+	m.now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestAllow(t *testing.T) {
+	m, advance := newTestMemory(60, time.Minute, 3)
+
+	// A new key gets a full bucket, so the first burst of requests are allowed straight away.
+	for i := 0; i < 3; i++ {
+		ok, retryAfter, err := m.Allow("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, true)
+		assert.Equal(t, retryAfter, time.Duration(0))
+	}
+
+	// The bucket is now empty, and refills at one token a second.
+	ok, retryAfter, _ := m.Allow("a")
+	assert.Equal(t, ok, false)
+	assert.Equal(t, retryAfter, time.Second)
+
+	// Other keys have buckets of their own.
+	ok, _, _ = m.Allow("b")
+	assert.Equal(t, ok, true)
+
+	advance(250 * time.Millisecond)
+	ok, retryAfter, _ = m.Allow("a")
+	assert.Equal(t, ok, false)
+	assert.Equal(t, retryAfter, 750*time.Millisecond)
+
+	advance(750 * time.Millisecond)
+	ok, _, _ = m.Allow("a")
+	assert.Equal(t, ok, true)
+	ok, _, _ = m.Allow("a")
+	assert.Equal(t, ok, false)
+
+	// However long a key is idle, its bucket never holds more than the burst size.
+	advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _, _ = m.Allow("a")
+		assert.Equal(t, ok, true)
+	}
+	ok, _, _ = m.Allow("a")
+	assert.Equal(t, ok, false)
+}
+
+func TestCleanup(t *testing.T) {
+	m, advance := newTestMemory(60, time.Minute, 3)
+
+	m.Allow("idle")
+	advance(time.Second)
+	m.Allow("busy")
+	m.Allow("busy")
+
+	// "idle" has refilled completely, but "busy" still has tokens missing.
+	advance(time.Second)
+	m.Cleanup()
+
+	_, idle := m.buckets["idle"]
+	_, busy := m.buckets["busy"]
+	assert.Equal(t, idle, false)
+	assert.Equal(t, busy, true)
+
+	advance(time.Second)
+	m.Cleanup()
+	assert.Equal(t, len(m.buckets), 0)
+}
@@ -11,6 +11,10 @@ import (
 // Parsing this pattern once at startup and storing the compiled *regexp.Regexp in a variable is more performant than re-parsing the pattern each time we need it.
 var EmailRX = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
 
+// UsernameRX matches a valid username: 3 to 30 lowercase letters, digits, hyphens and underscores, starting with a letter.
+// Usernames can't contain an @, so they can never be mistaken for an email address, and they can't be all digits, so they can never be mistaken for a user ID.
+var UsernameRX = regexp.MustCompile(`^[a-z][a-z0-9_-]{2,29}$`)
+
 // Define a new Validator type which contains a map of validation errors for our form fields.
 
 // Add a new NonFieldErrors []string field to the struct, which we will use to hold any validation errors which are not related to a specific form field.
@@ -0,0 +1,117 @@
+// Client-side encryption for snippets, using AES-GCM from the Web Crypto API.
+//
+// Encrypted content is sent to the server as "<nonce>.<ciphertext>", with both parts base64url-encoded
+// without padding. The 256-bit key is base64url-encoded into the fragment of the snippet's URL, which
+// browsers never send to the server.
+
+function toBase64URL(bytes) {
+	var binary = "";
+	for (var i = 0; i < bytes.length; i++) {
+		binary += String.fromCharCode(bytes[i]);
+	}
+	return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function fromBase64URL(text) {
+	var binary = atob(text.replace(/-/g, "+").replace(/_/g, "/"));
+	var bytes = new Uint8Array(binary.length);
+	for (var i = 0; i < binary.length; i++) {
+		bytes[i] = binary.charCodeAt(i);
+	}
+	return bytes;
+}
+
+// Encrypt the content of each file in the create form before it's submitted, if the user asked for it.
+// All of the files are encrypted with the same key, but each with its own nonce.
+var createForm = document.getElementById("create-snippet");
+if (createForm) {
+	createForm.addEventListener("submit", function (event) {
+		var encrypted = document.getElementById("encrypted");
+		var contents = createForm.querySelectorAll("textarea[name='content']");
+		if (!encrypted.checked) {
+			return;
+		}
+
+		event.preventDefault();
+
+		var key;
+		window.crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, true, ["encrypt"]).then(function (k) {
+			key = k;
+			var encryptions = [];
+			for (var i = 0; i < contents.length; i++) {
+				encryptions.push(encrypt(key, contents[i].value));
+			}
+			return Promise.all(encryptions);
+		}).then(function (ciphertexts) {
+			// Send the ciphertext in hidden fields, rather than in the textareas, so that the ciphertext is never shown back
+			// to the user if the form is re-displayed. The hidden fields are added in the same order as the textareas, so they
+			// still pair up with the filename and language fields.
+			for (var i = 0; i < contents.length; i++) {
+				var hidden = document.createElement("input");
+				hidden.type = "hidden";
+				hidden.name = "content";
+				hidden.value = ciphertexts[i];
+				contents[i].removeAttribute("name");
+				createForm.appendChild(hidden);
+			}
+			return window.crypto.subtle.exportKey("raw", key);
+		}).then(function (rawKey) {
+			// The server redirects to the new snippet without a fragment, so the browser keeps the one from the
+			// form's action URL. That's how the key ends up in the snippet's link without the server seeing it.
+			createForm.setAttribute("action", "/snippet/create#" + toBase64URL(new Uint8Array(rawKey)));
+			createForm.submit();
+		}).catch(function () {
+			alert("Your browser couldn't encrypt the snippet. Please try again without encryption.");
+		});
+	});
+}
+
+// encrypt() encrypts some text with a new random nonce, returning a promise of the nonce and ciphertext in the format stored by the server.
+// Empty text is left empty, so that the server can report that it's blank.
+function encrypt(key, text) {
+	if (text.trim() === "") {
+		return Promise.resolve("");
+	}
+
+	var nonce = window.crypto.getRandomValues(new Uint8Array(12));
+	return window.crypto.subtle.encrypt({ name: "AES-GCM", iv: nonce }, key, new TextEncoder().encode(text)).then(function (ciphertext) {
+		return toBase64URL(nonce) + "." + toBase64URL(new Uint8Array(ciphertext));
+	});
+}
+
+// Decrypt the content of each file in an encrypted snippet, using the key from the URL fragment.
+var encryptedContents = document.querySelectorAll("code.encrypted[data-ciphertext]");
+var keyText = window.location.hash.slice(1);
+
+if (encryptedContents.length > 0) {
+	if (keyText === "") {
+		for (var i = 0; i < encryptedContents.length; i++) {
+			encryptedContents[i].textContent = "This snippet is encrypted, and the link you followed doesn't include the key. Ask whoever shared it for the full link, including the part after the #.";
+		}
+	} else {
+		Promise.resolve().then(function () {
+			return window.crypto.subtle.importKey("raw", fromBase64URL(keyText), { name: "AES-GCM" }, false, ["decrypt"]);
+		}).then(function (key) {
+			encryptedContents.forEach(function (element) {
+				decrypt(key, element);
+			});
+		}).catch(function () {
+			encryptedContents.forEach(function (element) {
+				element.textContent = "This snippet couldn't be decrypted. Check that you have the full link, including the part after the #.";
+			});
+		});
+	}
+}
+
+function decrypt(key, element) {
+	var parts = element.getAttribute("data-ciphertext").split(".");
+
+	Promise.resolve().then(function () {
+		return window.crypto.subtle.decrypt({ name: "AES-GCM", iv: fromBase64URL(parts[0]) }, key, fromBase64URL(parts[1]));
+	}).then(function (plaintext) {
+		element.textContent = new TextDecoder().decode(plaintext);
+		element.classList.remove("encrypted");
+	}).catch(function () {
+		element.textContent = "This file couldn't be decrypted. Check that you have the full link, including the part after the #.";
+	});
+}
@@ -0,0 +1,43 @@
+// Add and remove files in the create and edit snippet forms. Each file is a fieldset containing a filename, language and content field,
+// so adding a file is just a matter of copying the last fieldset and clearing its values.
+var filesContainer = document.getElementById("files");
+var addFileButton = document.getElementById("add-file");
+
+// The maximum number of files in a snippet. This must match maxFiles in cmd/web/helpers.go.
+var maxFiles = 10;
+
+function updateFileButtons() {
+	var fieldsets = filesContainer.querySelectorAll("fieldset.file");
+	for (var i = 0; i < fieldsets.length; i++) {
+		fieldsets[i].querySelector(".remove-file").hidden = fieldsets.length === 1;
+	}
+	addFileButton.hidden = fieldsets.length >= maxFiles;
+}
+
+if (filesContainer && addFileButton) {
+	addFileButton.addEventListener("click", function () {
+		var fieldsets = filesContainer.querySelectorAll("fieldset.file");
+		var copy = fieldsets[fieldsets.length - 1].cloneNode(true);
+
+		copy.querySelector("input[name='filename']").value = "";
+		copy.querySelector("select[name='language']").selectedIndex = 0;
+		copy.querySelector("textarea").value = "";
+		var errors = copy.querySelectorAll(".error");
+		for (var i = 0; i < errors.length; i++) {
+			errors[i].remove();
+		}
+
+		filesContainer.appendChild(copy);
+		updateFileButtons();
+		copy.querySelector("input[name='filename']").focus();
+	});
+
+	filesContainer.addEventListener("click", function (event) {
+		if (event.target.classList.contains("remove-file")) {
+			event.target.closest("fieldset.file").remove();
+			updateFileButtons();
+		}
+	});
+
+	updateFileButtons();
+}
@@ -5,4 +5,122 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// The key for an encrypted snippet lives in the URL fragment, which browsers don't send to the server.
+// Forms marked with data-keep-fragment carry the fragment over to their action URL, so the key survives the
+// form being submitted (and any redirect which follows it).
+var keepFragmentForms = document.querySelectorAll("form[data-keep-fragment]");
+for (var i = 0; i < keepFragmentForms.length; i++) {
+	if (window.location.hash) {
+		var form = keepFragmentForms[i];
+		form.setAttribute("action", form.getAttribute("action") + window.location.hash);
+	}
+}
+
+// Tell the server the browser's offset from UTC, so that expiry dates entered in local time can be converted to UTC.
+var timezoneOffsetInputs = document.querySelectorAll("input[name='timezone_offset']");
+for (var i = 0; i < timezoneOffsetInputs.length; i++) {
+	timezoneOffsetInputs[i].value = new Date().getTimezoneOffset();
+}
+
+// Markdown files are shown rendered, with a button to switch to their source and back again.
+var toggleSourceButtons = document.querySelectorAll("button.toggle-source");
+for (var i = 0; i < toggleSourceButtons.length; i++) {
+	var button = toggleSourceButtons[i];
+	button.hidden = false;
+	button.addEventListener("click", function () {
+		var file = this.closest(".file");
+		var rendered = file.querySelector(".markdown");
+		var source = file.querySelector(".markdown-source");
+		rendered.hidden = !rendered.hidden;
+		source.hidden = !source.hidden;
+		this.textContent = source.hidden ? "Source" : "Rendered";
+	});
+}
+
+// Lines of highlighted files can be linked to with a URL fragment like #L10, or #L10-L20 for a range of lines. The lines of files
+// other than the first are prefixed with the file's number, like #F2-L10. The linked lines are highlighted, shift-clicking a line
+// number extends the range, and the new comment form offers to attach the comment to the highlighted lines.
+var lineRX = /^#(F(\d+)-)?L(\d+)(?:-L(\d+))?$/;
+
+function selectedLines() {
+	var match = lineRX.exec(window.location.hash);
+	if (!match) {
+		return null;
+	}
+	var start = parseInt(match[3], 10);
+	var end = match[4] ? parseInt(match[4], 10) : start;
+	return {
+		prefix: match[1] || "",
+		file: match[2] ? parseInt(match[2], 10) - 1 : 0,
+		start: Math.min(start, end),
+		end: Math.max(start, end)
+	};
+}
+
+function showSelectedLines() {
+	var highlighted = document.querySelectorAll("table.lines tr.hl");
+	for (var i = 0; i < highlighted.length; i++) {
+		highlighted[i].classList.remove("hl");
+	}
+
+	var selection = selectedLines();
+	var first = null;
+	if (selection) {
+		for (var n = selection.start; n <= selection.end; n++) {
+			var line = document.getElementById(selection.prefix + "L" + n);
+			if (line) {
+				line.classList.add("hl");
+				first = first || line;
+			}
+		}
+	}
+	if (!first) {
+		selection = null;
+	}
+
+	var form = document.querySelector("form.new-comment");
+	if (form) {
+		var selectedLinesDiv = form.querySelector(".selected-lines");
+		var attach = form.querySelector("#comment-on-lines").checked && selection;
+		selectedLinesDiv.hidden = !selection;
+		selectedLinesDiv.querySelector("span").textContent = selection ? window.location.hash.substring(1) : "";
+		form.elements["file"].value = attach ? selection.file : "";
+		form.elements["line_start"].value = attach ? selection.start : "";
+		form.elements["line_end"].value = attach ? selection.end : "";
+	}
+
+	return first;
+}
+
+if (document.querySelector("table.lines")) {
+	window.addEventListener("hashchange", showSelectedLines);
+
+	var commentOnLines = document.getElementById("comment-on-lines");
+	if (commentOnLines) {
+		commentOnLines.addEventListener("change", showSelectedLines);
+	}
+
+	// Browsers only scroll to a single line by themselves, so scroll to the start of a range too.
+	var firstSelectedLine = showSelectedLines();
+	if (firstSelectedLine) {
+		firstSelectedLine.scrollIntoView();
+	}
+
+	var lineLinks = document.querySelectorAll("table.lines td.ln a");
+	for (var i = 0; i < lineLinks.length; i++) {
+		lineLinks[i].addEventListener("click", function (event) {
+			var selection = selectedLines();
+			var match = lineRX.exec(this.getAttribute("href"));
+			if (!event.shiftKey || !selection || !match || (match[1] || "") !== selection.prefix) {
+				return;
+			}
+			event.preventDefault();
+			var line = parseInt(match[3], 10);
+			var start = Math.min(selection.start, line);
+			var end = Math.max(selection.start, line);
+			window.location.hash = selection.prefix + "L" + start + (end > start ? "-L" + end : "");
+		});
+	}
+}